@@ -19,16 +19,21 @@ just one MCP connection in their tools (Claude, Cursor, opencode) while accessin
 func init() {
 	rootCmd.AddCommand(cmd.NewInstallCmd())
 	rootCmd.AddCommand(cmd.NewAddCmd())
+	rootCmd.AddCommand(cmd.NewRemoveCmd())
 	rootCmd.AddCommand(cmd.NewListCmd())
 	rootCmd.AddCommand(cmd.NewSetKeyCmd())
 	rootCmd.AddCommand(cmd.NewGetKeysCmd())
 	rootCmd.AddCommand(cmd.NewRemoveKeyCmd())
+	rootCmd.AddCommand(cmd.NewKeysCmd())
 	rootCmd.AddCommand(cmd.NewConfigCmd())
 	rootCmd.AddCommand(cmd.NewStartCmd())
 	rootCmd.AddCommand(cmd.NewStartServerCmd())
 	rootCmd.AddCommand(cmd.NewStopServerCmd())
+	rootCmd.AddCommand(cmd.NewResetServerCmd())
 	rootCmd.AddCommand(cmd.NewStatusCmd())
 	rootCmd.AddCommand(cmd.NewWebCmd())
+	rootCmd.AddCommand(cmd.NewLogsCmd())
+	rootCmd.AddCommand(cmd.NewMigrateCmd())
 }
 
 func main() {
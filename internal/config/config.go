@@ -14,41 +14,90 @@ const (
 
 // Config represents the global configuration
 type Config struct {
-	Version   string     `json:"version"`
-	Gateway   GatewayConfig `json:"gateway"`
-	Web       WebConfig   `json:"web"`
-	AutoUpdate bool       `json:"auto_update"`
-	LogLevel   string     `json:"log_level"`
+	Version    string        `json:"version"`
+	Gateway    GatewayConfig `json:"gateway"`
+	Web        WebConfig     `json:"web"`
+	Logs       LogsConfig    `json:"logs"`
+	AutoUpdate bool          `json:"auto_update"`
+	LogLevel   string        `json:"log_level"`
 }
 
 // GatewayConfig holds gateway-specific settings
 type GatewayConfig struct {
-	Port   int    `json:"port"`
-	Host   string `json:"host"`
+	Port      int    `json:"port"`
+	Host      string `json:"host"`
 	Transport string `json:"transport"`
+
+	// ToolNaming selects how downstream tool names are exposed: "prefixed" or "none"
+	ToolNaming string `json:"tool_naming,omitempty"`
+	// ToolSeparator joins the server prefix and the tool name
+	ToolSeparator string `json:"tool_separator,omitempty"`
+	// RequestTimeout bounds requests proxied to servers, as a duration such as "2m";
+	// "0" disables it. Servers and tools can override it.
+	RequestTimeout string `json:"request_timeout,omitempty"`
+	// SecretCacheTTL is how long the output of "cmd:" credential references is
+	// reused, as a duration such as "5m"; "0" runs the command on every server start
+	SecretCacheTTL string `json:"secret_cache_ttl,omitempty"`
 }
 
+// Gateway transports
+const (
+	TransportStdio = "stdio"
+	TransportHTTP  = "http"
+	TransportSSE   = "sse"
+)
+
+const (
+	ToolNamingPrefixed = "prefixed"
+	ToolNamingNone     = "none"
+
+	DefaultToolSeparator = "__"
+)
+
 // WebConfig holds web interface settings
 type WebConfig struct {
-	Port   int    `json:"port"`
-	Host   string `json:"host"`
-	Enabled bool  `json:"enabled"`
+	Port    int    `json:"port"`
+	Host    string `json:"host"`
+	Enabled bool   `json:"enabled"`
 }
 
+// LogsConfig controls rotation of the per-server log files. Zero values use the defaults.
+type LogsConfig struct {
+	// MaxSizeMB rotates a log file once it grows past this size
+	MaxSizeMB int `json:"max_size_mb,omitempty"`
+	// MaxAgeHours rotates a log file once it has been written to for this long
+	MaxAgeHours int `json:"max_age_hours,omitempty"`
+	// MaxFiles is the number of rotated files kept per server
+	MaxFiles int `json:"max_files,omitempty"`
+}
+
+const (
+	DefaultLogMaxSizeMB   = 10
+	DefaultLogMaxAgeHours = 24 * 7
+	DefaultLogMaxFiles    = 5
+)
+
 // DefaultConfig returns a default configuration
 func DefaultConfig() *Config {
 	return &Config{
 		Version: "0.1.0",
 		Gateway: GatewayConfig{
-			Port:     5234,
-			Host:     "127.0.0.1",
-			Transport: "stdio",
+			Port:          5234,
+			Host:          "127.0.0.1",
+			Transport:     TransportStdio,
+			ToolNaming:    ToolNamingPrefixed,
+			ToolSeparator: DefaultToolSeparator,
 		},
 		Web: WebConfig{
 			Port:    80,
 			Host:    "0.0.0.0",
 			Enabled: true,
 		},
+		Logs: LogsConfig{
+			MaxSizeMB:   DefaultLogMaxSizeMB,
+			MaxAgeHours: DefaultLogMaxAgeHours,
+			MaxFiles:    DefaultLogMaxFiles,
+		},
 		AutoUpdate: true,
 		LogLevel:   "info",
 	}
@@ -108,4 +157,4 @@ func GetMCPDir() (string, error) {
 	}
 
 	return filepath.Join(homeDir, DefaultMCPDir), nil
-}
\ No newline at end of file
+}
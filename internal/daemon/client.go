@@ -0,0 +1,167 @@
+package daemon
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+)
+
+// ErrNotRunning is returned when no gateway daemon answers on the control socket
+var ErrNotRunning = errors.New("gateway daemon is not running (start it with 'onemcp start')")
+
+// requestTimeout bounds a control request; starting a server includes its handshake
+const requestTimeout = 90 * time.Second
+
+// Client talks to the gateway daemon over its control socket
+type Client struct {
+	http *http.Client
+
+	stream *http.Client // without a timeout, for relayed MCP connections
+}
+
+// NewClient creates a client for the daemon serving mcpDir
+func NewClient(mcpDir string) *Client {
+	path := SocketPath(mcpDir)
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		},
+	}
+	return &Client{
+		http:   &http.Client{Timeout: requestTimeout, Transport: transport},
+		stream: &http.Client{Transport: transport},
+	}
+}
+
+// ProxyMCP relays an MCP client speaking newline-delimited JSON-RPC on in and
+// out, such as over stdio, to the daemon's MCP server. It returns once either
+// side closes the connection or the context is cancelled.
+func (c *Client) ProxyMCP(ctx context.Context, in io.Reader, out io.Writer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://onemcp/v1/mcp", nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", MCPProtocol)
+
+	resp, err := c.stream.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return ErrNotRunning
+		}
+		return fmt.Errorf("control request failed: %w", err)
+	}
+	conn, ok := resp.Body.(io.ReadWriteCloser)
+	if resp.StatusCode != http.StatusSwitchingProtocols || !ok {
+		resp.Body.Close()
+		return fmt.Errorf("daemon refused the MCP connection: %s", resp.Status)
+	}
+	defer conn.Close()
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := io.Copy(conn, in)
+		done <- err
+	}()
+	go func() {
+		_, err := io.Copy(out, conn)
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+// ListServers returns the daemon's view of every server
+func (c *Client) ListServers() (map[string]*gateway.ServerInfo, error) {
+	var servers map[string]*gateway.ServerInfo
+	if err := c.do(http.MethodGet, "/v1/servers", &servers); err != nil {
+		return nil, err
+	}
+	return servers, nil
+}
+
+// AddServer asks the daemon to load a newly installed server
+func (c *Client) AddServer(name string) error {
+	return c.do(http.MethodPost, "/v1/servers/"+url.PathEscape(name), nil)
+}
+
+// RemoveServer asks the daemon to stop a server and delete it
+func (c *Client) RemoveServer(name string) error {
+	return c.do(http.MethodDelete, "/v1/servers/"+url.PathEscape(name), nil)
+}
+
+// StartServer asks the daemon to start a server
+func (c *Client) StartServer(name string) error {
+	return c.do(http.MethodPost, "/v1/servers/"+url.PathEscape(name)+"/start", nil)
+}
+
+// StopServer asks the daemon to stop a server
+func (c *Client) StopServer(name string) error {
+	return c.do(http.MethodPost, "/v1/servers/"+url.PathEscape(name)+"/stop", nil)
+}
+
+// ResetServer asks the daemon to clear a server's crash-loop state and start it again
+func (c *Client) ResetServer(name string) error {
+	return c.do(http.MethodPost, "/v1/servers/"+url.PathEscape(name)+"/reset", nil)
+}
+
+// do sends a control request and decodes the response into result, if not nil
+func (c *Client) do(method, path string, result interface{}) error {
+	resp, err := c.send(method, path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if result == nil {
+		io.Copy(io.Discard, resp.Body)
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("failed to parse daemon response: %w", err)
+	}
+	return nil
+}
+
+// send issues a control request, turning error responses into errors.
+// The caller must close the body of the returned response.
+func (c *Client) send(method, path string) (*http.Response, error) {
+	req, err := http.NewRequest(method, "http://onemcp"+path, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return nil, ErrNotRunning
+		}
+		return nil, fmt.Errorf("control request failed: %w", err)
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		var body errorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil || body.Error == "" {
+			return nil, fmt.Errorf("daemon returned %s", resp.Status)
+		}
+		return nil, errors.New(body.Error)
+	}
+	return resp, nil
+}
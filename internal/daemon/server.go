@@ -0,0 +1,247 @@
+package daemon
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// SocketName is the file name of the control socket inside the MCP directory
+const SocketName = "onemcp.sock"
+
+// ErrAlreadyRunning is returned when another gateway already owns the control socket
+var ErrAlreadyRunning = errors.New("gateway daemon is already running")
+
+// SocketPath returns the control socket path for an MCP directory
+func SocketPath(mcpDir string) string {
+	return filepath.Join(mcpDir, SocketName)
+}
+
+// MCPProtocol is the protocol a control connection is upgraded to in order to carry
+// an MCP client's newline-delimited JSON-RPC messages to the daemon's MCP server
+const MCPProtocol = "mcp"
+
+// Server exposes a gateway's process table over the control socket
+type Server struct {
+	gw  *gateway.Gateway
+	mcp *mcpsdk.Server
+}
+
+// NewServer creates a control server for gw. MCP clients relayed by later
+// 'onemcp start' processes are served by mcpServer.
+func NewServer(gw *gateway.Gateway, mcpServer *mcpsdk.Server) *Server {
+	return &Server{
+		gw:  gw,
+		mcp: mcpServer,
+	}
+}
+
+// Serve accepts control requests on listener until the context is cancelled
+func (s *Server) Serve(ctx context.Context, listener net.Listener) error {
+	httpServer := &http.Server{
+		Handler: s.handler(),
+		// Relayed MCP connections end with the daemon
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		httpServer.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("Control API listening on %s", listener.Addr())
+	if err := httpServer.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("control API failed: %w", err)
+	}
+	return nil
+}
+
+// Listen binds the control socket under mcpDir, replacing a stale socket left by
+// a crashed daemon. It returns ErrAlreadyRunning if a daemon answers on it.
+func Listen(mcpDir string) (net.Listener, error) {
+	path := SocketPath(mcpDir)
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+			conn.Close()
+			return nil, ErrAlreadyRunning
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale control socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on control socket: %w", err)
+	}
+
+	// Only the owner may control the gateway
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict control socket: %w", err)
+	}
+	return listener, nil
+}
+
+// handler builds the control API routes
+func (s *Server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v1/mcp", s.connectMCP)
+	mux.HandleFunc("GET /v1/servers", s.listServers)
+	mux.HandleFunc("POST /v1/servers/{name}", s.addServer)
+	mux.HandleFunc("DELETE /v1/servers/{name}", s.removeServer)
+	mux.HandleFunc("POST /v1/servers/{name}/start", s.startServer)
+	mux.HandleFunc("POST /v1/servers/{name}/stop", s.stopServer)
+	mux.HandleFunc("POST /v1/servers/{name}/reset", s.resetServer)
+	return mux
+}
+
+// connectMCP upgrades the connection and serves an MCP client over it until
+// either end closes it
+func (s *Server) connectMCP(w http.ResponseWriter, r *http.Request) {
+	if s.mcp == nil || !strings.EqualFold(r.Header.Get("Upgrade"), MCPProtocol) {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("expected an upgrade to %s", MCPProtocol))
+		return
+	}
+
+	conn, buf, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	defer conn.Close()
+	stop := context.AfterFunc(r.Context(), func() { conn.Close() })
+	defer stop()
+
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: " + MCPProtocol + "\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		return
+	}
+
+	upgraded := &upgradedConn{Conn: conn, reader: buf.Reader}
+	session, err := s.mcp.Connect(r.Context(), &mcpsdk.IOTransport{Reader: upgraded, Writer: upgraded}, nil)
+	if err != nil {
+		log.Printf("Failed to connect relayed MCP client: %v", err)
+		return
+	}
+	session.Wait()
+}
+
+// upgradedConn reads through the buffer of the HTTP server, which may hold
+// messages the client sent right after its upgrade request
+type upgradedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *upgradedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
+func (s *Server) listServers(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.gw.ListServers())
+}
+
+func (s *Server) addServer(w http.ResponseWriter, r *http.Request) {
+	name, ok := serverName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.gw.AddServer(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (s *Server) removeServer(w http.ResponseWriter, r *http.Request) {
+	name, ok := serverName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.gw.RemoveServer(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (s *Server) startServer(w http.ResponseWriter, r *http.Request) {
+	name, ok := serverName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.gw.StartServer(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (s *Server) stopServer(w http.ResponseWriter, r *http.Request) {
+	name, ok := serverName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.gw.StopServer(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+func (s *Server) resetServer(w http.ResponseWriter, r *http.Request) {
+	name, ok := serverName(w, r)
+	if !ok {
+		return
+	}
+	if err := s.gw.ResetServer(name); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"status": "success"})
+}
+
+// serverName returns the normalized server name of a request, answering the
+// request with an error if the name is invalid
+func serverName(w http.ResponseWriter, r *http.Request) (string, bool) {
+	name, err := storage.NormalizeServerName(r.PathValue("name"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return "", false
+	}
+	return name, true
+}
+
+// errorResponse is the body of a failed control request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// writeJSON writes v as the JSON response body
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write control response: %v", err)
+	}
+}
+
+// writeError writes err as a JSON error response
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, errorResponse{Error: err.Error()})
+}
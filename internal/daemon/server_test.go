@@ -0,0 +1,89 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+func TestSecondGatewayRelaysToDaemon(t *testing.T) {
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	mcpDir := t.TempDir()
+	store, err := storage.NewFileStorage(mcpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gw := gateway.NewGateway(config.DefaultConfig(), store)
+
+	mcpServer := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "onemcp", Version: "1.0.0"}, nil)
+	mcpsdk.AddTool(mcpServer, &mcpsdk.Tool{Name: "list_servers"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, args struct{}) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{}, nil, nil
+		})
+
+	listener, err := Listen(mcpDir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	served := make(chan error, 1)
+	go func() {
+		served <- NewServer(gw, mcpServer).Serve(ctx, listener)
+	}()
+	defer func() {
+		cancel()
+		<-served
+	}()
+
+	// A second gateway finds the socket taken
+	if _, err := Listen(mcpDir); !errors.Is(err, ErrAlreadyRunning) {
+		t.Fatalf("second Listen returned %v, want ErrAlreadyRunning", err)
+	}
+
+	// and relays its client to the daemon's MCP server
+	clientIn, proxyOut := io.Pipe()
+	proxyIn, clientOut := io.Pipe()
+	proxied := make(chan error, 1)
+	go func() {
+		proxied <- NewClient(mcpDir).ProxyMCP(ctx, proxyIn, proxyOut)
+	}()
+
+	client := mcpsdk.NewClient(&mcpsdk.Implementation{Name: "editor", Version: "1.0.0"}, nil)
+	session, err := client.Connect(ctx, &mcpsdk.IOTransport{Reader: clientIn, Writer: clientOut}, nil)
+	if err != nil {
+		t.Fatalf("Connect through the relay: %v", err)
+	}
+	tools, err := session.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("ListTools through the relay: %v", err)
+	}
+	if len(tools.Tools) != 1 || tools.Tools[0].Name != "list_servers" {
+		t.Errorf("tools = %+v, want the daemon's list_servers", tools.Tools)
+	}
+
+	// The relay ends when its client goes away
+	session.Close()
+	clientOut.Close()
+	select {
+	case <-proxied:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the relay outlived its client")
+	}
+}
+
+func TestProxyWithoutDaemon(t *testing.T) {
+	err := NewClient(t.TempDir()).ProxyMCP(context.Background(), nil, io.Discard)
+	if !errors.Is(err, ErrNotRunning) {
+		t.Errorf("ProxyMCP returned %v, want ErrNotRunning", err)
+	}
+}
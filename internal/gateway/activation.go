@@ -0,0 +1,283 @@
+package gateway
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// defaultIdleTimeout is how long an idle-timeout server may go without requests
+// before it is stopped, when its configuration does not say
+const defaultIdleTimeout = 10 * time.Minute
+
+// idleCheckInterval is how often servers are checked for idleness
+const idleCheckInterval = 15 * time.Second
+
+// activityState tracks the client requests a server is handling
+type activityState struct {
+	inflight int       // requests in progress
+	last     time.Time // when the last request started or finished
+	callers  []Client  // clients of the requests in progress, oldest first
+	mu       sync.Mutex
+
+	held    chan struct{} // closed when a server held for a restart takes requests again
+	restart func()        // restart due once no request is in progress
+
+	startMux sync.Mutex // serializes starts on first use
+}
+
+// onDemand reports whether the server is started on first use rather than with the gateway
+func (p *ServerProcess) onDemand() bool {
+	switch p.Config.Activation {
+	case storage.ActivationLazy, storage.ActivationIdleTimeout:
+		return true
+	}
+	return false
+}
+
+// begin records the start of a request to the server by client, which may be nil.
+// While the server is held for a restart, the request waits for it to finish.
+func (p *ServerProcess) begin(ctx context.Context, client Client) error {
+	p.activity.mu.Lock()
+	for p.activity.held != nil {
+		held := p.activity.held
+		p.activity.mu.Unlock()
+		select {
+		case <-held:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		p.activity.mu.Lock()
+	}
+	defer p.activity.mu.Unlock()
+
+	p.activity.inflight++
+	p.activity.last = time.Now()
+	if client != nil {
+		p.activity.callers = append(p.activity.callers, client)
+	}
+	return nil
+}
+
+// end records the end of a request to the server by client, running a restart
+// that waited for the server to become idle
+func (p *ServerProcess) end(client Client) {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+	p.activity.inflight--
+	p.activity.last = time.Now()
+	for i := len(p.activity.callers) - 1; i >= 0; i-- {
+		if client != nil && p.activity.callers[i] == client {
+			p.activity.callers = append(p.activity.callers[:i], p.activity.callers[i+1:]...)
+			break
+		}
+	}
+
+	if p.activity.inflight == 0 && p.activity.restart != nil && p.activity.held == nil {
+		p.startHeld()
+	}
+}
+
+// restartWhenIdle runs restart once no request to the server is in progress, so
+// that none is cut off. Requests arriving meanwhile wait until it returns. A
+// restart asked for while one is due or running replaces the one that is due.
+func (p *ServerProcess) restartWhenIdle(restart func()) {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+
+	p.activity.restart = restart
+	if p.activity.inflight > 0 || p.activity.held != nil {
+		log.Printf("Restarting server %s once its requests in progress are done", p.Name)
+		return
+	}
+	p.startHeld()
+}
+
+// startHeld holds the server and runs its due restart. Callers hold activity.mu.
+func (p *ServerProcess) startHeld() {
+	restart := p.activity.restart
+	p.activity.restart = nil
+	held := make(chan struct{})
+	p.activity.held = held
+
+	go func() {
+		restart()
+
+		p.activity.mu.Lock()
+		defer p.activity.mu.Unlock()
+		p.activity.held = nil
+		close(held)
+		if p.activity.restart != nil {
+			p.startHeld()
+		}
+	}()
+}
+
+// holding reports whether the server is held for a restart
+func (p *ServerProcess) holding() bool {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+	return p.activity.held != nil
+}
+
+// caller returns the client of the requests in progress, or nil if none are. Requests
+// a server sends carry nothing tying them to one of its calls, so while calls from
+// several clients are in progress the client cannot be told and caller fails.
+func (p *ServerProcess) caller() (Client, error) {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+
+	var caller Client
+	for _, client := range p.activity.callers {
+		if caller != nil && client != caller {
+			return nil, fmt.Errorf("server %s is handling requests from several clients, so it is unknown which one its request is for", p.Name)
+		}
+		caller = client
+	}
+	return caller, nil
+}
+
+// touch restarts the server's idle clock
+func (p *ServerProcess) touch() {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+	p.activity.last = time.Now()
+}
+
+// idleFor returns how long the server has gone without requests; zero while one is in progress
+func (p *ServerProcess) idleFor() time.Duration {
+	p.activity.mu.Lock()
+	defer p.activity.mu.Unlock()
+	if p.activity.inflight > 0 {
+		return 0
+	}
+	return time.Since(p.activity.last)
+}
+
+// activate starts an on-demand server that is not running, before a request is forwarded to it.
+// Other servers are left as they are.
+func (g *Gateway) activate(process *ServerProcess) error {
+	if !process.onDemand() || process.IsRunning() {
+		return nil
+	}
+
+	process.activity.startMux.Lock()
+	defer process.activity.startMux.Unlock()
+
+	// Another request may have started it meanwhile
+	if process.IsRunning() {
+		return nil
+	}
+	if g.stopping() {
+		return fmt.Errorf("server %s is not running: the gateway is shutting down", process.Name)
+	}
+	if process.Crashed() {
+		return fmt.Errorf("server %s is marked as errored; run 'onemcp reset-server %s' to start it again", process.Name, process.Name)
+	}
+
+	log.Printf("Starting server %s on first use", process.Name)
+	if err := g.StartServer(process.Name); err != nil {
+		return fmt.Errorf("failed to start server %s: %w", process.Name, err)
+	}
+	return nil
+}
+
+// ActivateUncataloged starts the on-demand servers whose catalog is not known yet,
+// so that a list request can include them. Servers are started in parallel.
+func (g *Gateway) ActivateUncataloged(ctx context.Context) {
+	g.serversMux.RLock()
+	var pending []*ServerProcess
+	for _, process := range g.servers {
+		if process.onDemand() && !process.cataloged() && !process.Crashed() {
+			pending = append(pending, process)
+		}
+	}
+	g.serversMux.RUnlock()
+
+	var wg sync.WaitGroup
+	for _, process := range pending {
+		wg.Add(1)
+		go func(process *ServerProcess) {
+			defer wg.Done()
+			if err := g.activate(process); err != nil {
+				log.Printf("Failed to activate server %s: %v", process.Name, err)
+			}
+		}(process)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	// The client gets whatever is known when it stops waiting
+	select {
+	case <-done:
+	case <-ctx.Done():
+	}
+}
+
+// cataloged reports whether the server's tools, resources and prompts have been discovered
+func (p *ServerProcess) cataloged() bool {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.catalogKnown
+}
+
+// monitorIdle stops idle-timeout servers that went without requests for too long
+func (g *Gateway) monitorIdle(ctx context.Context) {
+	ticker := time.NewTicker(idleCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			g.stopIdleServers()
+		}
+	}
+}
+
+// stopIdleServers stops every idle-timeout server past its idle timeout. Servers
+// with subscribed resources are kept, since clients are waiting on their updates.
+func (g *Gateway) stopIdleServers() {
+	g.serversMux.RLock()
+	var idle []*ServerProcess
+	for _, process := range g.servers {
+		if process.Config.Activation != storage.ActivationIdleTimeout || !process.IsRunning() {
+			continue
+		}
+		timeout := configDuration(process.Config, "idle_timeout", process.Config.IdleTimeout, defaultIdleTimeout)
+		if timeout <= 0 || process.idleFor() < timeout || g.hasSubscriptions(process.Name) {
+			continue
+		}
+		idle = append(idle, process)
+	}
+	g.serversMux.RUnlock()
+
+	for _, process := range idle {
+		log.Printf("Stopping idle server %s", process.Name)
+		if err := g.StopServer(process.Name); err != nil {
+			log.Printf("Failed to stop idle server %s: %v", process.Name, err)
+		}
+	}
+}
+
+// hasSubscriptions reports whether clients are subscribed to any resource of the server
+func (g *Gateway) hasSubscriptions(serverName string) bool {
+	g.subscriptionsMux.Lock()
+	defer g.subscriptionsMux.Unlock()
+
+	for uri := range g.subscriptions {
+		if name, _, ok := ParseResourceURI(uri); ok && name == serverName {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// helperServerEnv marks a run of the test binary as a child server, see TestHelperServer
+const helperServerEnv = "ONEMCP_HELPER_SERVER"
+
+// TestHelperServer is not a test: run by a server from helperServer, it serves an
+// echo tool over stdio until its stdin closes
+func TestHelperServer(t *testing.T) {
+	if os.Getenv(helperServerEnv) != "1" {
+		t.Skip("only runs as a child server")
+	}
+
+	server := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "helper", Version: "1.0.0"}, nil)
+	type echoArgs struct {
+		Text string `json:"text"`
+	}
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "echo"}, func(ctx context.Context, req *mcpsdk.CallToolRequest, args echoArgs) (*mcpsdk.CallToolResult, any, error) {
+		return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: args.Text}}}, nil, nil
+	})
+	server.Run(context.Background(), &mcpsdk.StdioTransport{})
+	os.Exit(0)
+}
+
+// helperServer returns the configuration of a local server played by the test binary
+func helperServer(name, activation string) *storage.ServerConfig {
+	return &storage.ServerConfig{
+		Name:          name,
+		Command:       os.Args[0],
+		Args:          []string{"-test.run=^TestHelperServer$"},
+		Env:           map[string]string{helperServerEnv: "1"},
+		RestartPolicy: storage.RestartNever,
+		Activation:    activation,
+	}
+}
+
+// newHelperGateway returns a gateway with the given servers installed, none started
+func newHelperGateway(t *testing.T, servers ...*storage.ServerConfig) *Gateway {
+	t.Helper()
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, serverConfig := range servers {
+		if err := store.SaveServerConfig(serverConfig); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g := NewGateway(config.DefaultConfig(), store)
+	t.Cleanup(g.stopAllServers)
+	return g
+}
+
+// echo calls the echo tool of a helper server
+func echo(t *testing.T, g *Gateway, server, text string) {
+	t.Helper()
+	result, err := g.CallTool(context.Background(), server+"__echo", json.RawMessage(`{"text":"`+text+`"}`))
+	if err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	if got := result.Content[0].(*mcpsdk.TextContent).Text; got != text {
+		t.Errorf("echo answered %q; want %q", got, text)
+	}
+}
+
+func TestLazyServerStartsOnFirstUse(t *testing.T) {
+	g := newHelperGateway(t, helperServer("lazy", storage.ActivationLazy), helperServer("listed", storage.ActivationLazy))
+
+	if err := g.startAllServers(); err != nil {
+		t.Fatal(err)
+	}
+	if g.IsServerRunning("lazy") || g.IsServerRunning("listed") {
+		t.Fatal("lazy servers were started with the gateway")
+	}
+
+	echo(t, g, "lazy", "hello")
+	if !g.IsServerRunning("lazy") {
+		t.Error("lazy server is not running after its first use")
+	}
+	if g.IsServerRunning("listed") {
+		t.Error("a call to one lazy server started another")
+	}
+
+	// Listing starts the servers whose catalog is not known yet
+	g.ActivateUncataloged(context.Background())
+	names := make(map[string]bool)
+	for _, tool := range g.ListTools() {
+		names[tool.Name] = true
+	}
+	if !names["lazy__echo"] || !names["listed__echo"] {
+		t.Errorf("ListTools = %v; want the tools of both lazy servers", names)
+	}
+}
+
+func TestIdleServerStopsAfterTimeout(t *testing.T) {
+	serverConfig := helperServer("idle", storage.ActivationIdleTimeout)
+	serverConfig.IdleTimeout = "50ms"
+	g := newHelperGateway(t, serverConfig)
+	echo(t, g, "idle", "hello")
+
+	g.serversMux.RLock()
+	process := g.servers["idle"]
+	g.serversMux.RUnlock()
+
+	// A server handling a request is never idle
+	if err := process.begin(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	g.stopIdleServers()
+	if !g.IsServerRunning("idle") {
+		t.Fatal("server was stopped with a request in progress")
+	}
+
+	// Nor is one with subscribed resources
+	process.end(nil)
+	g.subscriptions[ResourceURI("idle", "file:///notes.txt")] = 1
+	time.Sleep(100 * time.Millisecond)
+	g.stopIdleServers()
+	if !g.IsServerRunning("idle") {
+		t.Fatal("server was stopped with subscribed resources")
+	}
+
+	delete(g.subscriptions, ResourceURI("idle", "file:///notes.txt"))
+	g.stopIdleServers()
+	if g.IsServerRunning("idle") {
+		t.Fatal("server is still running past its idle timeout")
+	}
+
+	// The stopped server keeps offering its tools and starts again when used
+	if len(g.ListTools()) != 1 {
+		t.Errorf("ListTools = %v; want the idle server's tool", g.ListTools())
+	}
+	echo(t, g, "idle", "again")
+	if !g.IsServerRunning("idle") {
+		t.Error("idle server did not start again on use")
+	}
+}
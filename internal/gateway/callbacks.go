@@ -0,0 +1,303 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"slices"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// Client is a connected MCP client that servers can send requests to
+type Client interface {
+	CreateMessage(ctx context.Context, params *mcpsdk.CreateMessageParams) (*mcpsdk.CreateMessageResult, error)
+	Elicit(ctx context.Context, params *mcpsdk.ElicitParams) (*mcpsdk.ElicitResult, error)
+	ListRoots(ctx context.Context, params *mcpsdk.ListRootsParams) (*mcpsdk.ListRootsResult, error)
+}
+
+// connectedClient is a client together with the capabilities it declared
+type connectedClient struct {
+	client Client
+	caps   *mcpsdk.ClientCapabilities
+}
+
+// Client capabilities that servers can use through the gateway
+const (
+	capabilitySampling    = "sampling"
+	capabilityElicitation = "elicitation"
+)
+
+// supports reports whether the client declared the capability
+func (c *connectedClient) supports(capability string) bool {
+	if c.caps == nil {
+		return false
+	}
+	switch capability {
+	case capabilitySampling:
+		return c.caps.Sampling != nil
+	case capabilityElicitation:
+		return c.caps.Elicitation != nil
+	}
+	return false
+}
+
+// lacks reports whether offered misses a capability of caps
+func lacks(offered, caps *mcpsdk.ClientCapabilities) bool {
+	return (caps.Sampling != nil && offered.Sampling == nil) ||
+		(caps.Elicitation != nil && offered.Elicitation == nil)
+}
+
+type clientKey struct{}
+
+// WithClient returns a context for requests made by client, so that requests a
+// server sends while handling them go back to the same client
+func WithClient(ctx context.Context, client Client) context.Context {
+	return context.WithValue(ctx, clientKey{}, client)
+}
+
+// clientFrom returns the client a request was made by, if known
+func clientFrom(ctx context.Context) Client {
+	client, _ := ctx.Value(clientKey{}).(Client)
+	return client
+}
+
+// AddClient registers a client that completed its handshake. Running servers set
+// to restart for clients that were not offered a capability the client brings are
+// restarted to learn about it once they have no requests in progress; on-demand
+// ones are stopped then and learn about it on their next start. Other servers are
+// offered it when they next start.
+func (g *Gateway) AddClient(client Client, caps *mcpsdk.ClientCapabilities) {
+	g.clientsMux.Lock()
+	g.clients = append(g.clients, &connectedClient{client: client, caps: caps})
+
+	g.serversMux.RLock()
+	var outdated []*ServerProcess
+	for _, process := range g.servers {
+		if g.needsReoffer(process) {
+			outdated = append(outdated, process)
+		}
+	}
+	g.serversMux.RUnlock()
+	g.clientsMux.Unlock()
+
+	for _, process := range outdated {
+		go g.reoffer(process)
+	}
+
+	// The roots servers see are now those of the new client
+	g.notifyRootsChanged(outdated)
+}
+
+// RemoveClient forgets a client whose session has ended
+func (g *Gateway) RemoveClient(client Client) {
+	g.clientsMux.Lock()
+	for i, connected := range g.clients {
+		if connected.client == client {
+			g.clients = append(g.clients[:i], g.clients[i+1:]...)
+			break
+		}
+	}
+	g.clientsMux.Unlock()
+
+	g.notifyRootsChanged(nil)
+}
+
+// RootsChanged tells the running servers that the roots they see have changed
+func (g *Gateway) RootsChanged() {
+	g.notifyRootsChanged(nil)
+}
+
+// notifyRootsChanged tells the initialized servers, except those being restarted, that their roots changed
+func (g *Gateway) notifyRootsChanged(restarting []*ServerProcess) {
+	g.serversMux.RLock()
+	var notify []*session
+	for _, process := range g.servers {
+		if slices.Contains(restarting, process) {
+			continue
+		}
+		if sess := process.getSession(); sess != nil && process.initialized() {
+			notify = append(notify, sess)
+		}
+	}
+	g.serversMux.RUnlock()
+
+	for _, sess := range notify {
+		go func(sess *session) {
+			ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+			defer cancel()
+			if err := sess.notify(ctx, "notifications/roots/list_changed", &mcpsdk.RootsListChangedParams{}); err != nil {
+				log.Printf("Failed to notify server %s of changed roots: %v", sess.name, err)
+			}
+		}(sess)
+	}
+}
+
+// needsReoffer reports whether an initialized server set to restart for clients was
+// offered fewer client capabilities than are available now. The server is then
+// recorded as offered them, so that it is restarted only once. Callers hold
+// clientsMux; servers still in their handshake are checked again when it completes.
+func (g *Gateway) needsReoffer(process *ServerProcess) bool {
+	if !process.Config.RestartForClients || !process.initialized() {
+		return false
+	}
+
+	caps := g.capabilitiesFor(process)
+	process.clientMux.Lock()
+	defer process.clientMux.Unlock()
+	if process.offered == nil || !lacks(process.offered, caps) {
+		return false
+	}
+	process.offered = caps
+	return true
+}
+
+// reofferIfNeeded restarts a server that just completed its handshake if a client
+// with new capabilities connected meanwhile. It reports whether it did.
+func (g *Gateway) reofferIfNeeded(process *ServerProcess) bool {
+	g.clientsMux.Lock()
+	needed := g.needsReoffer(process)
+	g.clientsMux.Unlock()
+
+	if needed {
+		go g.reoffer(process)
+	}
+	return needed
+}
+
+// reoffer restarts a server so that its handshake offers the current client
+// capabilities. The restart waits for the server's requests in progress to end, and
+// its catalog stays listed meanwhile.
+func (g *Gateway) reoffer(process *ServerProcess) {
+	process.restartWhenIdle(func() {
+		if err := g.StopServer(process.Name); err != nil {
+			log.Printf("Failed to stop server %s for a new client: %v", process.Name, err)
+			return
+		}
+		if process.onDemand() {
+			return
+		}
+
+		log.Printf("Restarting server %s to offer it the capabilities of a new client", process.Name)
+		if err := g.StartServer(process.Name); err != nil {
+			log.Printf("Failed to restart server %s: %v", process.Name, err)
+		}
+	})
+}
+
+// capabilitiesFor returns the client capabilities to offer a server: sampling and
+// elicitation if a connected client has them, unless the server may not sample.
+// Roots are always offered; without clients the list is empty. Callers hold clientsMux.
+func (g *Gateway) capabilitiesFor(process *ServerProcess) *mcpsdk.ClientCapabilities {
+	caps := &mcpsdk.ClientCapabilities{}
+	caps.Roots.ListChanged = true
+	for _, connected := range g.clients {
+		if connected.supports(capabilitySampling) && !process.Config.DenySampling {
+			caps.Sampling = &mcpsdk.SamplingCapabilities{}
+		}
+		if connected.supports(capabilityElicitation) {
+			caps.Elicitation = &mcpsdk.ElicitationCapabilities{}
+		}
+	}
+	return caps
+}
+
+// offerCapabilities decides the client capabilities a server's handshake offers
+func (g *Gateway) offerCapabilities(process *ServerProcess) *mcpsdk.ClientCapabilities {
+	g.clientsMux.Lock()
+	defer g.clientsMux.Unlock()
+
+	caps := g.capabilitiesFor(process)
+	process.clientMux.Lock()
+	process.offered = caps
+	process.clientMux.Unlock()
+	return caps
+}
+
+// offeredCapabilities returns the client capabilities the server was offered, or nil
+// before its first handshake
+func (p *ServerProcess) offeredCapabilities() *mcpsdk.ClientCapabilities {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.offered
+}
+
+// clientFor picks the client to pass a server's request to: the one whose request
+// the server is handling, or else the most recently connected client with the
+// capability. While the server handles requests from several clients, its own
+// requests are refused rather than sent to a client they may not be meant for.
+// An empty capability matches any client.
+func (g *Gateway) clientFor(process *ServerProcess, capability string) (Client, error) {
+	caller, err := process.caller()
+	if err != nil {
+		return nil, err
+	}
+
+	g.clientsMux.Lock()
+	defer g.clientsMux.Unlock()
+
+	for i := len(g.clients) - 1; i >= 0; i-- {
+		connected := g.clients[i]
+		if caller != nil && connected.client != caller {
+			continue
+		}
+		if capability == "" || connected.supports(capability) {
+			return connected.client, nil
+		}
+		if caller != nil {
+			return nil, fmt.Errorf("the client calling server %s does not support %s", process.Name, capability)
+		}
+	}
+
+	if caller != nil {
+		return nil, fmt.Errorf("the client calling server %s has disconnected", process.Name)
+	}
+	if capability == "" {
+		return nil, nil
+	}
+	return nil, fmt.Errorf("no connected client supports %s", capability)
+}
+
+// handleRequest answers a request a server sends to its client by passing it on
+// to a connected client
+func (g *Gateway) handleRequest(ctx context.Context, process *ServerProcess, method string, params json.RawMessage) (interface{}, error) {
+	switch method {
+	case "sampling/createMessage":
+		if process.Config.DenySampling {
+			return nil, wireError(CodeInvalidRequest, fmt.Sprintf("sampling is not allowed for server %s", process.Name))
+		}
+		var request mcpsdk.CreateMessageParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, wireError(CodeInvalidParams, err.Error())
+		}
+		client, err := g.clientFor(process, capabilitySampling)
+		if err != nil {
+			return nil, wireError(CodeInvalidRequest, err.Error())
+		}
+		return client.CreateMessage(ctx, &request)
+
+	case "elicitation/create":
+		var request mcpsdk.ElicitParams
+		if err := json.Unmarshal(params, &request); err != nil {
+			return nil, wireError(CodeInvalidParams, err.Error())
+		}
+		client, err := g.clientFor(process, capabilityElicitation)
+		if err != nil {
+			return nil, wireError(CodeInvalidRequest, err.Error())
+		}
+		return client.Elicit(ctx, &request)
+
+	case "roots/list":
+		client, err := g.clientFor(process, "")
+		if err != nil {
+			return nil, wireError(CodeInvalidRequest, err.Error())
+		}
+		if client == nil {
+			return &mcpsdk.ListRootsResult{Roots: []*mcpsdk.Root{}}, nil
+		}
+		return client.ListRoots(ctx, &mcpsdk.ListRootsParams{})
+	}
+
+	return nil, wireError(CodeMethodNotFound, fmt.Sprintf("method %s not supported by gateway", method))
+}
@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// fakeClient is a connected client that is only compared, never called
+type fakeClient struct {
+	Client
+	name string
+}
+
+// newTestProcess returns a server process that is never started
+func newTestProcess(name string) *ServerProcess {
+	return &ServerProcess{Name: name, Config: &storage.ServerConfig{Name: name}}
+}
+
+func TestClientForCaller(t *testing.T) {
+	sampling := &mcpsdk.ClientCapabilities{Sampling: &mcpsdk.SamplingCapabilities{}}
+	first, second := &fakeClient{name: "first"}, &fakeClient{name: "second"}
+	g := &Gateway{clients: []*connectedClient{{client: first, caps: sampling}, {client: second, caps: sampling}}}
+	process := newTestProcess("github")
+	ctx := context.Background()
+
+	// Without a call in progress, the most recently connected client is asked
+	if client, err := g.clientFor(process, capabilitySampling); err != nil || client != second {
+		t.Errorf("clientFor without a caller = %v, %v; want the second client", client, err)
+	}
+
+	// A server handling calls of one client asks that client, however many calls
+	process.begin(ctx, first)
+	process.begin(ctx, first)
+	if client, err := g.clientFor(process, capabilitySampling); err != nil || client != first {
+		t.Errorf("clientFor with one caller = %v, %v; want the first client", client, err)
+	}
+
+	// With calls of two clients in progress, the request cannot be attributed
+	process.begin(ctx, second)
+	if client, err := g.clientFor(process, capabilitySampling); err == nil {
+		t.Errorf("clientFor with two callers = %v, want an error", client)
+	}
+
+	process.end(first)
+	process.end(first)
+	if client, err := g.clientFor(process, capabilitySampling); err != nil || client != second {
+		t.Errorf("clientFor once the first client's calls ended = %v, %v; want the second client", client, err)
+	}
+}
+
+func TestRestartWhenIdle(t *testing.T) {
+	process := newTestProcess("github")
+	ctx := context.Background()
+
+	ran := make(chan struct{})
+	proceed := make(chan struct{})
+	process.begin(ctx, nil)
+	process.restartWhenIdle(func() {
+		close(ran)
+		<-proceed
+	})
+
+	select {
+	case <-ran:
+		t.Fatal("the restart ran while a request was in progress")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The end of the last request starts the restart
+	process.end(nil)
+	select {
+	case <-ran:
+	case <-time.After(time.Second):
+		t.Fatal("the restart did not run once the server was idle")
+	}
+
+	// Requests arriving during the restart wait for it, unless they are cancelled
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if err := process.begin(cancelled, nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("cancelled request during the restart: %v, want context.Canceled", err)
+	}
+
+	begun := make(chan error, 1)
+	go func() { begun <- process.begin(ctx, nil) }()
+	select {
+	case <-begun:
+		t.Fatal("a request began during the restart")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(proceed)
+	select {
+	case err := <-begun:
+		if err != nil {
+			t.Errorf("request after the restart: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the waiting request did not begin after the restart")
+	}
+	process.end(nil)
+}
+
+func TestNewClientRestartsOnlyOptedInServers(t *testing.T) {
+	g := &Gateway{clients: []*connectedClient{
+		{client: &fakeClient{name: "editor"}, caps: &mcpsdk.ClientCapabilities{Sampling: &mcpsdk.SamplingCapabilities{}}},
+	}}
+
+	optedIn, other, starting := newTestProcess("writer"), newTestProcess("github"), newTestProcess("slack")
+	optedIn.Config.RestartForClients = true
+	starting.Config.RestartForClients = true
+	for _, process := range []*ServerProcess{optedIn, other} {
+		process.initResult = &mcpsdk.InitializeResult{}
+		process.offered = &mcpsdk.ClientCapabilities{}
+	}
+
+	if !g.needsReoffer(optedIn) {
+		t.Error("a server set to restart for clients was not restarted for sampling")
+	}
+	if g.needsReoffer(optedIn) {
+		t.Error("a server was restarted twice for the same capabilities")
+	}
+	if g.needsReoffer(other) {
+		t.Error("a server not set to restart for clients was restarted")
+	}
+	if g.needsReoffer(starting) {
+		t.Error("a server still in its handshake was restarted")
+	}
+}
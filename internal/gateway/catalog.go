@@ -0,0 +1,134 @@
+package gateway
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// cachedCatalog is a server's catalog as persisted between gateway runs. It is
+// only used while it matches the package version and configuration it was built from.
+type cachedCatalog struct {
+	Version    string                     `json:"version,omitempty"`
+	ConfigHash string                     `json:"config_hash"`
+	UpdatedAt  time.Time                  `json:"updated_at"`
+	Tools      []*mcpsdk.Tool             `json:"tools,omitempty"`
+	Resources  []*mcpsdk.Resource         `json:"resources,omitempty"`
+	Templates  []*mcpsdk.ResourceTemplate `json:"resource_templates,omitempty"`
+	Prompts    []*mcpsdk.Prompt           `json:"prompts,omitempty"`
+}
+
+// configHash fingerprints the parts of a server configuration that can change its catalog
+func configHash(serverConfig *storage.ServerConfig) (string, error) {
+	hashed := *serverConfig
+	hashed.Status = ""
+	hashed.InstalledAt = time.Time{}
+
+	data, err := json.Marshal(&hashed)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash server config: %w", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// loadCatalog fills in a server's catalog from the cache, if the cached copy is current.
+// It reports whether a catalog was loaded.
+func (g *Gateway) loadCatalog(process *ServerProcess) bool {
+	data, err := os.ReadFile(g.storage.GetCatalogPath(process.Name))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Failed to read cached catalog of server %s: %v", process.Name, err)
+		}
+		return false
+	}
+
+	var cached cachedCatalog
+	if err := json.Unmarshal(data, &cached); err != nil {
+		log.Printf("Ignoring corrupt cached catalog of server %s: %v", process.Name, err)
+		return false
+	}
+
+	hash, err := configHash(process.Config)
+	if err != nil || cached.Version != process.Config.Version || cached.ConfigHash != hash {
+		log.Printf("Cached catalog of server %s is out of date", process.Name)
+		return false
+	}
+
+	process.clientMux.Lock()
+	process.tools = cached.Tools
+	process.resources = cached.Resources
+	process.templates = cached.Templates
+	process.prompts = cached.Prompts
+	process.catalogKnown = true
+	process.clientMux.Unlock()
+	return true
+}
+
+// saveCatalog persists a server's discovered catalog
+func (g *Gateway) saveCatalog(process *ServerProcess) error {
+	hash, err := configHash(process.Config)
+	if err != nil {
+		return err
+	}
+
+	process.clientMux.RLock()
+	cached := &cachedCatalog{
+		Version:    process.Config.Version,
+		ConfigHash: hash,
+		UpdatedAt:  time.Now(),
+		Tools:      process.tools,
+		Resources:  process.resources,
+		Templates:  process.templates,
+		Prompts:    process.prompts,
+	}
+	data, err := json.MarshalIndent(cached, "", "  ")
+	process.clientMux.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to encode catalog: %w", err)
+	}
+
+	path := g.storage.GetCatalogPath(process.Name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog cache directory: %w", err)
+	}
+
+	// Write through a temporary file so a crash never leaves a partial catalog
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write catalog cache: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write catalog cache: %w", err)
+	}
+	return nil
+}
+
+// reuseUnchanged replaces the entries of current that equal an entry of previous
+// with that entry, so unchanged entries keep their identity. It reports whether
+// current differs from previous.
+func reuseUnchanged[T any](previous, current []*T, key func(*T) string) ([]*T, bool) {
+	byKey := make(map[string]*T, len(previous))
+	for _, entry := range previous {
+		byKey[key(entry)] = entry
+	}
+
+	changed := len(previous) != len(current)
+	for i, entry := range current {
+		if old, ok := byKey[key(entry)]; ok && reflect.DeepEqual(old, entry) {
+			current[i] = old
+		} else {
+			changed = true
+		}
+	}
+	return current, changed
+}
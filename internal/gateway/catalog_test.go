@@ -0,0 +1,67 @@
+package gateway
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newCachedServer installs a server that cannot be spawned, with a cached catalog
+// of one tool, and returns its storage
+func newCachedServer(t *testing.T, status storage.ServerStatus) *storage.FileStorage {
+	t.Helper()
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &storage.ServerConfig{
+		Name:          "broken",
+		Version:       "1.0.0",
+		Status:        status,
+		Command:       filepath.Join(t.TempDir(), "missing"),
+		RestartPolicy: storage.RestartNever,
+	}
+	if err := store.SaveServerConfig(serverConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	process := gw.servers["broken"]
+	process.tools = []*mcpsdk.Tool{{Name: "search"}}
+	if err := gw.saveCatalog(process); err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestCatalogCacheLoaded(t *testing.T) {
+	store := newCachedServer(t, storage.StatusInstalled)
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	if tools := gw.ListTools(); len(tools) != 1 || tools[0].Name != "broken__search" {
+		t.Fatalf("tools = %+v, want the cached broken__search", tools)
+	}
+
+	// Nothing serves the cached tools once the server fails to spawn
+	if err := gw.StartServer("broken"); err == nil {
+		t.Fatal("StartServer succeeded without an executable")
+	}
+	if tools := gw.ListTools(); len(tools) != 0 {
+		t.Errorf("tools = %+v after the spawn failed, want none", tools)
+	}
+	if gw.servers["broken"].getSession() != nil {
+		t.Error("the failed server kept its session")
+	}
+}
+
+func TestCatalogCacheSkippedForErroredServers(t *testing.T) {
+	store := newCachedServer(t, storage.StatusError)
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	if tools := gw.ListTools(); len(tools) != 0 {
+		t.Errorf("tools = %+v for a server in error, want none", tools)
+	}
+}
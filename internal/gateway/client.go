@@ -0,0 +1,296 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ProtocolVersion is the MCP protocol version the gateway requests from child servers
+const ProtocolVersion = "2025-06-18"
+
+// clientInfo identifies the gateway to child servers during initialization
+var clientInfo = &mcpsdk.Implementation{
+	Name:    "onemcp",
+	Version: "0.1.0",
+}
+
+// Initialize performs the MCP initialize handshake with the server, offering it caps
+func (p *ServerProcess) Initialize(ctx context.Context, caps *mcpsdk.ClientCapabilities) error {
+	session := p.getSession()
+	if session == nil {
+		return fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	params := &mcpsdk.InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		ClientInfo:      clientInfo,
+		Capabilities:    caps,
+	}
+
+	var result mcpsdk.InitializeResult
+	if err := session.call(ctx, "initialize", params, &result); err != nil {
+		return fmt.Errorf("initialize failed: %w", err)
+	}
+
+	if err := session.notify(ctx, "notifications/initialized", &mcpsdk.InitializedParams{}); err != nil {
+		return err
+	}
+
+	p.clientMux.Lock()
+	p.initResult = &result
+	p.clientMux.Unlock()
+
+	// Connections that track protocol state learn about the negotiated session
+	if conn, ok := session.conn.(interface {
+		initialized(*mcpsdk.InitializeResult)
+	}); ok {
+		conn.initialized(&result)
+	}
+	return nil
+}
+
+// ListTools fetches every tool the server exposes, following pagination cursors
+func (p *ServerProcess) ListTools(ctx context.Context) ([]*mcpsdk.Tool, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var tools []*mcpsdk.Tool
+	params := &mcpsdk.ListToolsParams{}
+	for {
+		var result mcpsdk.ListToolsResult
+		if err := session.call(ctx, "tools/list", params, &result); err != nil {
+			return nil, fmt.Errorf("tools/list failed: %w", err)
+		}
+		tools = append(tools, result.Tools...)
+
+		if result.NextCursor == "" {
+			return tools, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// CallTool invokes a tool on the server and returns its result unchanged
+func (p *ServerProcess) CallTool(ctx context.Context, name string, args json.RawMessage) (*mcpsdk.CallToolResult, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	params := &mcpsdk.CallToolParamsRaw{
+		Name:      name,
+		Arguments: args,
+	}
+
+	var result mcpsdk.CallToolResult
+	if err := session.call(ctx, "tools/call", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// ListResources fetches every resource the server exposes, following pagination cursors
+func (p *ServerProcess) ListResources(ctx context.Context) ([]*mcpsdk.Resource, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var resources []*mcpsdk.Resource
+	params := &mcpsdk.ListResourcesParams{}
+	for {
+		var result mcpsdk.ListResourcesResult
+		if err := session.call(ctx, "resources/list", params, &result); err != nil {
+			return nil, fmt.Errorf("resources/list failed: %w", err)
+		}
+		resources = append(resources, result.Resources...)
+
+		if result.NextCursor == "" {
+			return resources, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// ListResourceTemplates fetches every resource template the server exposes
+func (p *ServerProcess) ListResourceTemplates(ctx context.Context) ([]*mcpsdk.ResourceTemplate, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var templates []*mcpsdk.ResourceTemplate
+	params := &mcpsdk.ListResourceTemplatesParams{}
+	for {
+		var result mcpsdk.ListResourceTemplatesResult
+		if err := session.call(ctx, "resources/templates/list", params, &result); err != nil {
+			return nil, fmt.Errorf("resources/templates/list failed: %w", err)
+		}
+		templates = append(templates, result.ResourceTemplates...)
+
+		if result.NextCursor == "" {
+			return templates, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// ReadResource reads a resource from the server
+func (p *ServerProcess) ReadResource(ctx context.Context, uri string) (*mcpsdk.ReadResourceResult, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var result mcpsdk.ReadResourceResult
+	if err := session.call(ctx, "resources/read", &mcpsdk.ReadResourceParams{URI: uri}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Subscribe asks the server to send update notifications for a resource
+func (p *ServerProcess) Subscribe(ctx context.Context, uri string) error {
+	session := p.getSession()
+	if session == nil {
+		return fmt.Errorf("server %s is not running", p.Name)
+	}
+	return session.call(ctx, "resources/subscribe", &mcpsdk.SubscribeParams{URI: uri}, nil)
+}
+
+// Unsubscribe stops update notifications for a resource
+func (p *ServerProcess) Unsubscribe(ctx context.Context, uri string) error {
+	session := p.getSession()
+	if session == nil {
+		return fmt.Errorf("server %s is not running", p.Name)
+	}
+	return session.call(ctx, "resources/unsubscribe", &mcpsdk.UnsubscribeParams{URI: uri}, nil)
+}
+
+// ListPrompts fetches every prompt the server exposes, following pagination cursors
+func (p *ServerProcess) ListPrompts(ctx context.Context) ([]*mcpsdk.Prompt, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var prompts []*mcpsdk.Prompt
+	params := &mcpsdk.ListPromptsParams{}
+	for {
+		var result mcpsdk.ListPromptsResult
+		if err := session.call(ctx, "prompts/list", params, &result); err != nil {
+			return nil, fmt.Errorf("prompts/list failed: %w", err)
+		}
+		prompts = append(prompts, result.Prompts...)
+
+		if result.NextCursor == "" {
+			return prompts, nil
+		}
+		params.Cursor = result.NextCursor
+	}
+}
+
+// GetPrompt renders a prompt on the server
+func (p *ServerProcess) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcpsdk.GetPromptResult, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	params := &mcpsdk.GetPromptParams{
+		Name:      name,
+		Arguments: args,
+	}
+
+	var result mcpsdk.GetPromptResult
+	if err := session.call(ctx, "prompts/get", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Complete asks the server for argument completions
+func (p *ServerProcess) Complete(ctx context.Context, params *mcpsdk.CompleteParams) (*mcpsdk.CompleteResult, error) {
+	session := p.getSession()
+	if session == nil {
+		return nil, fmt.Errorf("server %s is not running", p.Name)
+	}
+
+	var result mcpsdk.CompleteResult
+	if err := session.call(ctx, "completion/complete", params, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// initialized reports whether the handshake with the server's current session has completed
+func (p *ServerProcess) initialized() bool {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.initResult != nil
+}
+
+// Capabilities returns the capabilities the server advertised during initialization
+func (p *ServerProcess) Capabilities() *mcpsdk.ServerCapabilities {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+
+	if p.initResult == nil || p.initResult.Capabilities == nil {
+		return &mcpsdk.ServerCapabilities{}
+	}
+	return p.initResult.Capabilities
+}
+
+// dispatchNotification passes a server notification to the registered handler.
+// It runs on the session's read loop, so handlers must not wait on calls to the same server.
+func (p *ServerProcess) dispatchNotification(method string, params json.RawMessage) {
+	if p.onNotification != nil {
+		p.onNotification(p, method, params)
+	}
+}
+
+// dispatchRequest passes a request from the server to the registered handler
+func (p *ServerProcess) dispatchRequest(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+	if p.onRequest == nil {
+		return nil, wireError(CodeMethodNotFound, fmt.Sprintf("method %s not supported by gateway", method))
+	}
+	return p.onRequest(ctx, p, method, params)
+}
+
+// hasTool reports whether the server advertised a tool with the given name
+func (p *ServerProcess) hasTool(name string) bool {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+
+	for _, tool := range p.tools {
+		if tool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// hasPrompt reports whether the server advertised a prompt with the given name
+func (p *ServerProcess) hasPrompt(name string) bool {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+
+	for _, prompt := range p.prompts {
+		if prompt.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// getSession returns the JSON-RPC session with the current process, if any
+func (p *ServerProcess) getSession() *session {
+	p.clientMux.RLock()
+	defer p.clientMux.RUnlock()
+	return p.session
+}
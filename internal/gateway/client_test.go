@@ -0,0 +1,404 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// addPipeServer adds a running server, played by a fake child, to the gateway
+func addPipeServer(t *testing.T, g *Gateway, serverConfig *storage.ServerConfig) (*ServerProcess, *fakeChild) {
+	t.Helper()
+	process := &ServerProcess{
+		Name:           serverConfig.Name,
+		Config:         serverConfig,
+		onNotification: g.handleNotification,
+		onRequest:      g.handleRequest,
+	}
+	sess, child := newPipeSession(t, process.dispatchNotification, process.dispatchRequest)
+	process.attachSession(sess)
+
+	g.serversMux.Lock()
+	g.servers[serverConfig.Name] = process
+	g.serversMux.Unlock()
+	return process, child
+}
+
+// serve answers the gateway's requests in the background, until the connection
+// closes, with the JSON results handle returns. Notifications are not answered.
+func (c *fakeChild) serve(handle func(method string, params json.RawMessage) string) {
+	go func() {
+		for {
+			line, err := c.reader.ReadBytes('\n')
+			if err != nil {
+				return
+			}
+			msg, err := jsonrpc.DecodeMessage(line)
+			if err != nil {
+				return
+			}
+			req, ok := msg.(*jsonrpc.Request)
+			if !ok || !req.ID.IsValid() {
+				continue
+			}
+			data, err := jsonrpc.EncodeMessage(&jsonrpc.Response{ID: req.ID, Result: json.RawMessage(handle(req.Method, req.Params))})
+			if err != nil {
+				return
+			}
+			if _, err := c.writer.Write(append(data, '\n')); err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// initializeResult is a server's answer to initialize, with the given capabilities
+func initializeResult(name, capabilities string) string {
+	return fmt.Sprintf(`{"protocolVersion":%q,"capabilities":%s,"serverInfo":{"name":%q,"version":"1.0.0"}}`,
+		ProtocolVersion, capabilities, name)
+}
+
+// cursor returns the pagination cursor of a list request
+func cursor(params json.RawMessage) string {
+	var page struct {
+		Cursor string `json:"cursor"`
+	}
+	json.Unmarshal(params, &page)
+	return page.Cursor
+}
+
+// textResult is a tool result holding text
+func textResult(text string) string {
+	return fmt.Sprintf(`{"content":[{"type":"text","text":%q}]}`, text)
+}
+
+// initialize runs the handshake and catalog discovery of a server
+func initialize(t *testing.T, g *Gateway, process *ServerProcess) {
+	t.Helper()
+	if err := g.initializeServer(process); err != nil {
+		t.Fatalf("initializing %s: %v", process.Name, err)
+	}
+}
+
+func TestToolsAggregatedAcrossServers(t *testing.T) {
+	g, github, githubChild := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	fs, fsChild := addPipeServer(t, g, &storage.ServerConfig{Name: "fs"})
+
+	githubChild.serve(func(method string, params json.RawMessage) string {
+		switch method {
+		case "initialize":
+			return initializeResult("github", `{"tools":{}}`)
+		case "tools/list":
+			// The catalog is fetched page by page
+			if cursor(params) == "" {
+				return `{"tools":[{"name":"search","inputSchema":{"type":"object"}}],"nextCursor":"2"}`
+			}
+			return `{"tools":[{"name":"create_issue","inputSchema":{"type":"object"}}]}`
+		case "tools/call":
+			return textResult("github")
+		}
+		return `{}`
+	})
+	fsChild.serve(func(method string, params json.RawMessage) string {
+		switch method {
+		case "initialize":
+			return initializeResult("fs", `{"tools":{}}`)
+		case "tools/list":
+			return `{"tools":[{"name":"search","inputSchema":{"type":"object"}}]}`
+		case "tools/call":
+			return textResult("fs")
+		}
+		return `{}`
+	})
+	initialize(t, g, github)
+	initialize(t, g, fs)
+
+	got := make(map[string]string)
+	for _, tool := range g.ListTools() {
+		got[tool.Name] = tool.Server + "/" + tool.Tool.Name
+	}
+	want := map[string]string{
+		"github__search":       "github/search",
+		"github__create_issue": "github/create_issue",
+		"fs__search":           "fs/search",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ListTools = %v; want %v", got, want)
+	}
+
+	// Calls reach the server the exposed name belongs to
+	for name, server := range map[string]string{"github__search": "github", "fs__search": "fs", "github__create_issue": "github"} {
+		result, err := g.CallTool(context.Background(), name, json.RawMessage(`{}`))
+		if err != nil {
+			t.Fatalf("CallTool(%s): %v", name, err)
+		}
+		if text := result.Content[0].(*mcpsdk.TextContent).Text; text != server {
+			t.Errorf("CallTool(%s) answered by %s; want %s", name, text, server)
+		}
+	}
+
+	if _, err := g.CallTool(context.Background(), "slack__search", json.RawMessage(`{}`)); err == nil {
+		t.Error("CallTool of a tool no server provides succeeded")
+	}
+}
+
+func TestUnprefixedToolsResolvedByOwner(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Gateway.ToolNaming = config.ToolNamingNone
+	g, github, githubChild := newPipeGateway(t, cfg, &storage.ServerConfig{Name: "github"})
+	fs, fsChild := addPipeServer(t, g, &storage.ServerConfig{Name: "fs"})
+	github.tools = []*mcpsdk.Tool{{Name: "create_issue"}}
+	fs.tools = []*mcpsdk.Tool{{Name: "read_file"}}
+
+	var called []string
+	var mu sync.Mutex
+	answer := func(server string) func(string, json.RawMessage) string {
+		return func(method string, params json.RawMessage) string {
+			var call mcpsdk.CallToolParamsRaw
+			json.Unmarshal(params, &call)
+			mu.Lock()
+			called = append(called, server+"/"+call.Name)
+			mu.Unlock()
+			return textResult(server)
+		}
+	}
+	githubChild.serve(answer("github"))
+	fsChild.serve(answer("fs"))
+
+	names := make(map[string]bool)
+	for _, tool := range g.ListTools() {
+		names[tool.Name] = true
+	}
+	if !names["create_issue"] || !names["read_file"] || len(names) != 2 {
+		t.Errorf("ListTools = %v; want the tools under their own names", names)
+	}
+
+	for _, name := range []string{"read_file", "create_issue"} {
+		if _, err := g.CallTool(context.Background(), name, json.RawMessage(`{}`)); err != nil {
+			t.Fatalf("CallTool(%s): %v", name, err)
+		}
+	}
+	if want := []string{"fs/read_file", "github/create_issue"}; !reflect.DeepEqual(called, want) {
+		t.Errorf("servers got calls %v; want %v", called, want)
+	}
+}
+
+func TestResourcesAggregatedAcrossServers(t *testing.T) {
+	g, github, githubChild := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	fs, fsChild := addPipeServer(t, g, &storage.ServerConfig{Name: "fs"})
+
+	var requests []string
+	var mu sync.Mutex
+	githubChild.serve(func(method string, params json.RawMessage) string {
+		mu.Lock()
+		requests = append(requests, method)
+		mu.Unlock()
+		switch method {
+		case "initialize":
+			return initializeResult("github", `{"resources":{"subscribe":true}}`)
+		case "resources/list":
+			if cursor(params) == "" {
+				return `{"resources":[{"uri":"repo://onemcp/README.md","name":"readme"}],"nextCursor":"2"}`
+			}
+			return `{"resources":[{"uri":"repo://onemcp/LICENSE","name":"license"}]}`
+		case "resources/templates/list":
+			return `{"resourceTemplates":[{"uriTemplate":"repo://{owner}/{repo}","name":"repository"}]}`
+		case "resources/read":
+			return `{"contents":[{"uri":"repo://onemcp/README.md","text":"# OneMCP"}]}`
+		}
+		return `{}`
+	})
+	fsChild.serve(func(method string, params json.RawMessage) string {
+		switch method {
+		case "initialize":
+			return initializeResult("fs", `{"resources":{}}`)
+		case "resources/list":
+			return `{"resources":[{"uri":"file:///tmp/notes.txt","name":"notes"}]}`
+		}
+		return `{}`
+	})
+	initialize(t, g, github)
+	initialize(t, g, fs)
+
+	uris := make(map[string]string)
+	for _, resource := range g.ListResources() {
+		uris[resource.URI] = resource.Server
+	}
+	want := map[string]string{
+		"onemcp://github/repo://onemcp/README.md": "github",
+		"onemcp://github/repo://onemcp/LICENSE":   "github",
+		"onemcp://fs/file:///tmp/notes.txt":       "fs",
+	}
+	if !reflect.DeepEqual(uris, want) {
+		t.Errorf("ListResources = %v; want %v", uris, want)
+	}
+
+	templates := g.ListResourceTemplates()
+	if len(templates) != 1 || templates[0].URITemplate != "onemcp://github/repo://{owner}/{repo}" {
+		t.Errorf("ListResourceTemplates = %v; want the github template under the gateway scheme", templates)
+	}
+
+	// Reads reach the owning server, and the contents carry the exposed URI
+	result, err := g.ReadResource(context.Background(), "onemcp://github/repo://onemcp/README.md")
+	if err != nil {
+		t.Fatalf("ReadResource: %v", err)
+	}
+	if uri := result.Contents[0].URI; uri != "onemcp://github/repo://onemcp/README.md" {
+		t.Errorf("ReadResource contents URI = %s; want the exposed URI", uri)
+	}
+	if _, err := g.ReadResource(context.Background(), "onemcp://slack/channel://general"); err == nil {
+		t.Error("ReadResource of an unknown server succeeded")
+	}
+
+	// The server is subscribed for the first subscriber and unsubscribed after the last
+	const readme = "onemcp://github/repo://onemcp/README.md"
+	for i := 0; i < 2; i++ {
+		if err := g.SubscribeResource(context.Background(), readme); err != nil {
+			t.Fatalf("SubscribeResource: %v", err)
+		}
+	}
+	updated := make(chan string, 1)
+	g.OnResourceUpdated(func(uri string) { updated <- uri })
+	githubChild.write(&jsonrpc.Request{Method: "notifications/resources/updated", Params: json.RawMessage(`{"uri":"repo://onemcp/README.md"}`)})
+	if uri := <-updated; uri != readme {
+		t.Errorf("clients were told %s was updated; want %s", uri, readme)
+	}
+	for i := 0; i < 2; i++ {
+		if err := g.UnsubscribeResource(context.Background(), readme); err != nil {
+			t.Fatalf("UnsubscribeResource: %v", err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	subscriptions := make(map[string]int)
+	for _, method := range requests {
+		subscriptions[method]++
+	}
+	if subscriptions["resources/subscribe"] != 1 || subscriptions["resources/unsubscribe"] != 1 {
+		t.Errorf("server got %d subscribe and %d unsubscribe requests; want one each",
+			subscriptions["resources/subscribe"], subscriptions["resources/unsubscribe"])
+	}
+
+	// A server without subscription support is not asked
+	if err := g.SubscribeResource(context.Background(), "onemcp://fs/file:///tmp/notes.txt"); err == nil {
+		t.Error("SubscribeResource on a server without subscriptions succeeded")
+	}
+}
+
+func TestPromptsAndCompletionForwarded(t *testing.T) {
+	g, github, githubChild := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	fs, fsChild := addPipeServer(t, g, &storage.ServerConfig{Name: "fs"})
+
+	forwarded := make(chan json.RawMessage, 4)
+	githubChild.serve(func(method string, params json.RawMessage) string {
+		switch method {
+		case "initialize":
+			return initializeResult("github", `{"prompts":{},"resources":{},"completions":{}}`)
+		case "prompts/list":
+			if cursor(params) == "" {
+				return `{"prompts":[{"name":"review"}],"nextCursor":"2"}`
+			}
+			return `{"prompts":[{"name":"triage"}]}`
+		case "resources/templates/list":
+			return `{"resourceTemplates":[{"uriTemplate":"repo://{owner}/{repo}","name":"repository"}]}`
+		case "prompts/get", "completion/complete":
+			forwarded <- params
+			if method == "prompts/get" {
+				return `{"messages":[{"role":"user","content":{"type":"text","text":"review it"}}]}`
+			}
+			return `{"completion":{"values":["onemcp"],"total":1}}`
+		}
+		return `{}`
+	})
+	fsChild.serve(func(method string, params json.RawMessage) string {
+		switch method {
+		case "initialize":
+			return initializeResult("fs", `{"prompts":{}}`)
+		case "prompts/list":
+			return `{"prompts":[{"name":"summarize"}]}`
+		}
+		return `{}`
+	})
+	initialize(t, g, github)
+	initialize(t, g, fs)
+
+	prompts := make(map[string]string)
+	for _, prompt := range g.ListPrompts() {
+		prompts[prompt.Name] = prompt.Server + "/" + prompt.Prompt.Name
+	}
+	want := map[string]string{
+		"github__review": "github/review",
+		"github__triage": "github/triage",
+		"fs__summarize":  "fs/summarize",
+	}
+	if !reflect.DeepEqual(prompts, want) {
+		t.Errorf("ListPrompts = %v; want %v", prompts, want)
+	}
+
+	// Prompts are rendered by their server under the downstream name
+	result, err := g.GetPrompt(context.Background(), "github__review", map[string]string{"pr": "42"})
+	if err != nil {
+		t.Fatalf("GetPrompt: %v", err)
+	}
+	if len(result.Messages) != 1 {
+		t.Errorf("GetPrompt messages = %v; want the server's", result.Messages)
+	}
+	var get mcpsdk.GetPromptParams
+	json.Unmarshal(<-forwarded, &get)
+	if get.Name != "review" || get.Arguments["pr"] != "42" {
+		t.Errorf("server got prompt %q with %v; want review with the client's arguments", get.Name, get.Arguments)
+	}
+
+	// Completion references are translated back to the server's names
+	tests := []struct {
+		ref  *mcpsdk.CompleteReference
+		want mcpsdk.CompleteReference
+	}{
+		{
+			ref:  &mcpsdk.CompleteReference{Type: "ref/prompt", Name: "github__triage"},
+			want: mcpsdk.CompleteReference{Type: "ref/prompt", Name: "triage"},
+		},
+		{
+			ref:  &mcpsdk.CompleteReference{Type: "ref/resource", URI: "onemcp://github/repo://{owner}/{repo}"},
+			want: mcpsdk.CompleteReference{Type: "ref/resource", URI: "repo://{owner}/{repo}"},
+		},
+	}
+	for _, tt := range tests {
+		params := &mcpsdk.CompleteParams{Ref: tt.ref, Argument: mcpsdk.CompleteParamsArgument{Name: "repo", Value: "one"}}
+		result, err := g.Complete(context.Background(), params)
+		if err != nil {
+			t.Fatalf("Complete(%+v): %v", tt.ref, err)
+		}
+		if !reflect.DeepEqual(result.Completion.Values, []string{"onemcp"}) {
+			t.Errorf("Complete(%+v) = %v; want the server's suggestions", tt.ref, result.Completion.Values)
+		}
+
+		var got mcpsdk.CompleteParams
+		json.Unmarshal(<-forwarded, &got)
+		if *got.Ref != tt.want || got.Argument.Value != "one" {
+			t.Errorf("server got completion of %+v for %q; want %+v", *got.Ref, got.Argument.Value, tt.want)
+		}
+		if params.Ref != tt.ref || params.Ref.Name != tt.ref.Name || params.Ref.URI != tt.ref.URI {
+			t.Errorf("Complete changed the client's reference to %+v", params.Ref)
+		}
+	}
+
+	// A server without completion support offers no suggestions
+	empty, err := g.Complete(context.Background(), &mcpsdk.CompleteParams{Ref: &mcpsdk.CompleteReference{Type: "ref/prompt", Name: "fs__summarize"}})
+	if err != nil || len(empty.Completion.Values) != 0 {
+		t.Errorf("Complete on a server without completions = %v, %v; want no suggestions", empty, err)
+	}
+
+	if _, err := g.Complete(context.Background(), &mcpsdk.CompleteParams{Ref: &mcpsdk.CompleteReference{Type: "ref/tool", Name: "github__search"}}); err == nil {
+		t.Error("Complete of an unsupported reference succeeded")
+	}
+}
@@ -0,0 +1,185 @@
+package gateway
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// baseInheritEnv lists the gateway environment variables every local server gets,
+// since interpreters and package runners need them to work at all
+var baseInheritEnv = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "LC_*", "TZ", "TERM",
+	"TMPDIR", "TMP", "TEMP",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
+	// Windows
+	"SYSTEMROOT", "SYSTEMDRIVE", "WINDIR", "COMSPEC", "PATHEXT", "USERPROFILE",
+	"APPDATA", "LOCALAPPDATA", "PROGRAMDATA", "PROGRAMFILES", "PROGRAMFILES(X86)",
+}
+
+// buildCommand builds the command that launches a local server, with its
+// arguments, working directory and environment. Templates in the configured args
+// and env are resolved here, so undefined references fail before anything runs.
+func (g *Gateway) buildCommand(process *ServerProcess) (*exec.Cmd, error) {
+	line, err := baseCommand(process.Config)
+	if err != nil {
+		return nil, &ConfigError{Err: err}
+	}
+
+	values := &templateValues{
+		config: process.Config.Config,
+		mcpDir: g.storage.GetBaseDir(),
+	}
+	creds, err := g.storage.LoadCredentials(process.Name)
+	if err == nil {
+		values.creds = creds.Data
+	} else if !errors.Is(err, storage.ErrNoCredentials) {
+		return nil, err
+	}
+
+	line = append(line, values.expandArgs(process.Config.Args)...)
+	env := g.serverEnv(process, values)
+	if err := values.err(); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command(line[0], line[1:]...)
+	cmd.Dir = process.Config.Cwd
+	cmd.Env = env
+	return cmd, nil
+}
+
+// secretCacheTTL returns the configured cache TTL of secret commands, if any
+func (g *Gateway) secretCacheTTL() (time.Duration, bool) {
+	value := g.config.Gateway.SecretCacheTTL
+	if value == "" {
+		return 0, false
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Ignoring invalid secret_cache_ttl %q", value)
+		return 0, false
+	}
+	return d, true
+}
+
+// describeCommand shows the command line of a local server with its templates
+// unresolved, so that logging it does not reveal credentials
+func describeCommand(serverConfig *storage.ServerConfig) string {
+	line, err := baseCommand(serverConfig)
+	if err != nil {
+		return ""
+	}
+	return strings.Join(append(line, serverConfig.Args...), " ")
+}
+
+// baseCommand returns the command of a local server, before its configured Args.
+// Configurations written before Command existed derive it from Path, the way each
+// server type used to be launched.
+func baseCommand(serverConfig *storage.ServerConfig) ([]string, error) {
+	if serverConfig.Command != "" {
+		return []string{serverConfig.Command}, nil
+	}
+
+	var line []string
+	switch serverConfig.Type {
+	case storage.ServerTypeNPM:
+		// Path is a binary or "node <script>"; either may contain spaces
+		if script, ok := strings.CutPrefix(serverConfig.Path, "node "); ok {
+			line = []string{"node", script}
+		} else if serverConfig.Path != "" {
+			line = []string{serverConfig.Path}
+		}
+	case storage.ServerTypePIP:
+		if serverConfig.Path != "" {
+			line = []string{"python3", serverConfig.Path}
+		}
+	case storage.ServerTypeCustom:
+		line = strings.Fields(serverConfig.Path)
+	default:
+		return nil, fmt.Errorf("unsupported server type: %s", serverConfig.Type)
+	}
+
+	if len(line) == 0 {
+		return nil, fmt.Errorf("server %s has no command configured", serverConfig.Name)
+	}
+	return line, nil
+}
+
+// serverEnv returns the environment of a local server: the allowed part of the
+// gateway's environment, then the server's Env, then its credentials
+func (g *Gateway) serverEnv(process *ServerProcess, values *templateValues) []string {
+	allowed := append(append([]string{}, baseInheritEnv...), process.Config.InheritEnv...)
+
+	var env []string
+	for _, entry := range os.Environ() {
+		name, _, _ := strings.Cut(entry, "=")
+		if inherits(allowed, name) {
+			env = append(env, entry)
+		}
+	}
+
+	for key, value := range process.Config.Env {
+		env = append(env, fmt.Sprintf("%s=%s", key, values.expand(value)))
+	}
+
+	// Later entries win, so credentials override everything above
+	for key, value := range values.creds {
+		env = append(env, fmt.Sprintf("%s=%s", key, value))
+	}
+	return env
+}
+
+// inherits reports whether an environment variable matches the allow-list.
+// Windows variable names are case-insensitive.
+func inherits(allowed []string, name string) bool {
+	if runtime.GOOS == "windows" {
+		name = strings.ToUpper(name)
+	}
+
+	for _, pattern := range allowed {
+		if runtime.GOOS == "windows" {
+			pattern = strings.ToUpper(pattern)
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(name, prefix) {
+				return true
+			}
+		} else if pattern == name {
+			return true
+		}
+	}
+	return false
+}
+
+// migrateFilesystemArgs moves the allowed directories of a filesystem server from
+// its ALLOWED_DIRECTORIES credential into its arguments. The gateway used to add
+// them to the command of any npm package named like "filesystem".
+func (g *Gateway) migrateFilesystemArgs(serverConfig *storage.ServerConfig) {
+	if serverConfig.Type != storage.ServerTypeNPM || serverConfig.Command != "" || len(serverConfig.Args) > 0 ||
+		!strings.Contains(serverConfig.Package, "filesystem") {
+		return
+	}
+
+	// The credential stays the source of the directories
+	dirs := "/tmp" // what the gateway used to default to
+	if creds, err := g.storage.LoadStoredCredentials(serverConfig.Name); err == nil &&
+		(creds.Data["ALLOWED_DIRECTORIES"] != "" || creds.Refs["ALLOWED_DIRECTORIES"] != "") {
+		dirs = "${cred:ALLOWED_DIRECTORIES}"
+	}
+
+	serverConfig.Args = []string{dirs}
+	if err := g.storage.SaveServerConfig(serverConfig); err != nil {
+		log.Printf("Failed to save the arguments of server %s: %v", serverConfig.Name, err)
+		return
+	}
+	log.Printf("Server %s now gets its allowed directories from the args in its configuration", serverConfig.Name)
+}
@@ -0,0 +1,102 @@
+package gateway
+
+import (
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+func TestBuildCommandEnvironment(t *testing.T) {
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+	t.Setenv("PATH", "/usr/bin")
+	t.Setenv("LC_ALL", "C.UTF-8")
+	t.Setenv("AWS_REGION", "eu-west-1")
+	t.Setenv("AWS_PROFILE", "dev")
+	t.Setenv("ONEMCP_TEST_SECRET", "not for servers")
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cwd := t.TempDir()
+	if err := store.SaveServerConfig(&storage.ServerConfig{
+		Name:       "aws",
+		Command:    "aws-mcp",
+		Args:       []string{"--region", "${env:AWS_REGION}"},
+		Cwd:        cwd,
+		InheritEnv: []string{"AWS_*"},
+		Env: map[string]string{
+			"PATH":      "/opt/aws/bin",
+			"LOG_LEVEL": "debug",
+			"API_TOKEN": "from env",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveCredentials("aws", &storage.Credential{Data: map[string]string{"API_TOKEN": "from credentials"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	g := NewGateway(config.DefaultConfig(), store)
+	cmd, err := g.buildCommand(g.servers["aws"])
+	if err != nil {
+		t.Fatalf("buildCommand: %v", err)
+	}
+
+	if want := []string{"aws-mcp", "--region", "eu-west-1"}; !reflect.DeepEqual(cmd.Args, want) {
+		t.Errorf("command line = %v; want %v", cmd.Args, want)
+	}
+	if cmd.Dir != cwd {
+		t.Errorf("working directory = %q; want %q", cmd.Dir, cwd)
+	}
+
+	// Later entries win, as they do for the started process
+	env := make(map[string]string)
+	for _, entry := range cmd.Env {
+		name, value, _ := strings.Cut(entry, "=")
+		env[name] = value
+	}
+	want := map[string]string{
+		"PATH":        "/opt/aws/bin",     // the server's env overrides the gateway's
+		"LC_ALL":      "C.UTF-8",          // inherited by every server
+		"AWS_REGION":  "eu-west-1",        // allowed for this server
+		"AWS_PROFILE": "dev",              // allowed for this server
+		"LOG_LEVEL":   "debug",            // the server's env
+		"API_TOKEN":   "from credentials", // credentials override the server's env
+	}
+	for name, value := range want {
+		if env[name] != value {
+			t.Errorf("%s = %q; want %q", name, env[name], value)
+		}
+	}
+	if value, ok := env["ONEMCP_TEST_SECRET"]; ok {
+		t.Errorf("ONEMCP_TEST_SECRET = %q leaked to the server", value)
+	}
+}
+
+func TestInherits(t *testing.T) {
+	allowed := []string{"PATH", "LC_*", "AWS_*"}
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"PATH", true},
+		{"LC_CTYPE", true},
+		{"AWS_SECRET_ACCESS_KEY", true},
+		{"PATHEXT", false},
+		{"MY_PATH", false},
+		{"GITHUB_TOKEN", false},
+		{"Path", runtime.GOOS == "windows"},
+	}
+	for _, tt := range tests {
+		if got := inherits(allowed, tt.name); got != tt.want {
+			t.Errorf("inherits(%s) = %v; want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -1,8 +1,10 @@
 package gateway
 
 import (
+	"bufio"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -14,7 +16,9 @@ import (
 	"time"
 
 	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/logs"
 	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 // Gateway represents the MCP gateway server
@@ -23,6 +27,22 @@ type Gateway struct {
 	storage    *storage.FileStorage
 	servers    map[string]*ServerProcess
 	serversMux sync.RWMutex
+	namer      *ToolNamer
+
+	listeners         []func()
+	resourceListeners []func(uri string)
+	listenersMux      sync.Mutex
+
+	subscriptions    map[string]int // exposed resource URI -> subscriber count
+	subscriptionsMux sync.Mutex
+
+	progress progressRoutes
+
+	clients    []*connectedClient // in order of connection
+	clientsMux sync.Mutex
+
+	done  chan struct{} // closed when the gateway shuts down
+	clock clock         // schedules restarts
 }
 
 // ServerProcess represents a running MCP server process
@@ -34,15 +54,50 @@ type ServerProcess struct {
 	Stdout     io.ReadCloser
 	Stderr     io.ReadCloser
 	running    bool
+	stopped    bool          // stopped on request; the monitor leaves it down
+	exited     chan struct{} // closed once the process has exited
 	runningMux sync.RWMutex
+	restart    restartState
+	health     healthState
+	activity   activityState
+
+	session    *session
+	initResult *mcpsdk.InitializeResult
+	tools      []*mcpsdk.Tool
+	resources  []*mcpsdk.Resource
+	templates  []*mcpsdk.ResourceTemplate
+	prompts    []*mcpsdk.Prompt
+	clientMux  sync.RWMutex
+
+	catalogKnown bool // the catalog above has been discovered at least once
+
+	offered *mcpsdk.ClientCapabilities // client capabilities offered in the last handshake
+
+	onNotification func(p *ServerProcess, method string, params json.RawMessage)
+	onRequest      func(ctx context.Context, p *ServerProcess, method string, params json.RawMessage) (interface{}, error)
 }
 
+// initializeTimeout bounds the handshake and catalog discovery of a newly started server
+const initializeTimeout = 60 * time.Second
+
+// defaultStopGracePeriod is how long each stage of stopping a server waits for it to exit
+const defaultStopGracePeriod = 5 * time.Second
+
 // NewGateway creates a new MCP gateway
 func NewGateway(cfg *config.Config, store *storage.FileStorage) *Gateway {
 	gw := &Gateway{
 		config:  cfg,
 		storage: store,
 		servers: make(map[string]*ServerProcess),
+		namer:   NewToolNamer(cfg.Gateway),
+
+		subscriptions: make(map[string]int),
+		done:          make(chan struct{}),
+		clock:         systemClock{},
+	}
+
+	if ttl, ok := gw.secretCacheTTL(); ok {
+		store.RegisterSecretProvider(storage.SecretSchemeCommand, storage.NewCommandProvider(ttl))
 	}
 
 	// Load all installed servers
@@ -64,15 +119,26 @@ func (g *Gateway) loadServers() {
 	g.serversMux.Lock()
 	defer g.serversMux.Unlock()
 
+	cached := 0
 	for _, serverConfig := range servers {
+		g.migrateFilesystemArgs(serverConfig)
 		process := &ServerProcess{
-			Name:   serverConfig.Name,
-			Config: serverConfig,
+			Name:           serverConfig.Name,
+			Config:         serverConfig,
+			onNotification: g.handleNotification,
+			onRequest:      g.handleRequest,
+		}
+		// A crash-looping server stays down across gateway restarts until it is reset,
+		// so it has no catalog to offer
+		process.restart.crashed = serverConfig.Status == storage.StatusError
+		// Clients are answered from the cached catalog until the server reports its own
+		if !process.restart.crashed && g.loadCatalog(process) {
+			cached++
 		}
 		g.servers[serverConfig.Name] = process
 	}
 
-	log.Printf("Loaded %d MCP servers", len(g.servers))
+	log.Printf("Loaded %d MCP servers (%d with a cached catalog)", len(g.servers), cached)
 }
 
 // startAllServers starts all installed MCP servers
@@ -88,12 +154,28 @@ func (g *Gateway) startAllServers() error {
 
 	var errors []string
 	for _, name := range serverNames {
+		g.serversMux.RLock()
+		process := g.servers[name]
+		g.serversMux.RUnlock()
+
+		if process.Crashed() {
+			log.Printf("Server %s is marked as errored; run 'onemcp reset-server %s' to start it again", name, name)
+			continue
+		}
+		if process.onDemand() {
+			log.Printf("Server %s starts on first use", name)
+			continue
+		}
+
 		log.Printf("Attempting to start server: %s", name)
 		if err := g.StartServer(name); err != nil {
 			// Only log as error if it's not "already running"
 			if !strings.Contains(err.Error(), "already running") {
 				log.Printf("Failed to start server %s: %v", name, err)
 				errors = append(errors, fmt.Sprintf("%s: %v", name, err))
+				if !process.IsRunning() {
+					g.scheduleRestart(process, true)
+				}
 			} else {
 				log.Printf("Server %s already running", name)
 			}
@@ -108,7 +190,7 @@ func (g *Gateway) startAllServers() error {
 	return nil
 }
 
-// monitorServers monitors server health and restarts failed servers
+// monitorServers monitors server health and restarts servers that went down unnoticed
 func (g *Gateway) monitorServers(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -123,7 +205,8 @@ func (g *Gateway) monitorServers(ctx context.Context) {
 	}
 }
 
-// checkAndRestartServers checks all servers and restarts any that have stopped
+// checkAndRestartServers schedules a restart, subject to each server's restart
+// policy, for any server that is down without one pending
 func (g *Gateway) checkAndRestartServers() {
 	g.serversMux.RLock()
 	serverNames := make([]string, 0, len(g.servers))
@@ -137,17 +220,13 @@ func (g *Gateway) checkAndRestartServers() {
 		process, exists := g.servers[name]
 		g.serversMux.RUnlock()
 
-		if !exists {
+		// On-demand servers are started by the requests that need them
+		if !exists || process.onDemand() {
 			continue
 		}
 
 		if !process.IsRunning() {
-			log.Printf("Server %s is not running, attempting to restart...", name)
-			if err := g.StartServer(name); err != nil {
-				log.Printf("Failed to restart server %s: %v", name, err)
-			} else {
-				log.Printf("Successfully restarted server: %s", name)
-			}
+			g.scheduleRestart(process, process.exitFailed())
 		}
 	}
 }
@@ -164,70 +243,135 @@ func (g *Gateway) Start(ctx context.Context) error {
 
 	// Start server health monitoring
 	go g.monitorServers(ctx)
+	go g.monitorIdle(ctx)
 
 	// Keep the gateway running
 	<-ctx.Done()
+	close(g.done)
+
+	log.Printf("Stopping all MCP servers...")
+	g.stopAllServers()
 	return nil
 }
 
-// StartServer starts a specific MCP server
-func (g *Gateway) StartServer(serverName string) error {
-	g.serversMux.Lock()
-	defer g.serversMux.Unlock()
+// stopAllServers stops every running server in parallel
+func (g *Gateway) stopAllServers() {
+	g.serversMux.RLock()
+	serverNames := make([]string, 0, len(g.servers))
+	for name, process := range g.servers {
+		if process.IsRunning() {
+			serverNames = append(serverNames, name)
+		}
+	}
+	g.serversMux.RUnlock()
 
+	var wg sync.WaitGroup
+	for _, name := range serverNames {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			if err := g.StopServer(name); err != nil {
+				log.Printf("Failed to stop server %s: %v", name, err)
+			}
+		}(name)
+	}
+	wg.Wait()
+}
+
+// stopping reports whether the gateway is shutting down
+func (g *Gateway) stopping() bool {
+	select {
+	case <-g.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// StartServer starts a specific MCP server and discovers its tools
+func (g *Gateway) StartServer(serverName string) error {
+	g.serversMux.RLock()
 	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
 	if !exists {
 		return fmt.Errorf("server %s not found", serverName)
 	}
 
-	if process.IsRunning() {
-		log.Printf("Server %s is already running", serverName)
-		return nil // Not an error, just already running
+	start := g.startProcess
+	if process.Config.Type == storage.ServerTypeRemote {
+		start = g.connectServer
 	}
 
-	// Build the command based on server type and configuration
-	var cmd *exec.Cmd
-	var err error
+	running, started, err := start(serverName)
+	if err != nil {
+		var configErr *ConfigError
+		if errors.As(err, &configErr) {
+			g.markErrored(process, err)
+		}
+		// A server that could not be started has no session to end, so its
+		// catalog, possibly loaded from the cache, is dropped here
+		g.dropCatalog(process)
+		return err
+	}
+	if !started {
+		return nil
+	}
 
-	switch process.Config.Type {
-	case storage.ServerTypeNPM:
-		cmd, err = g.buildNPMCommand(process)
-	case storage.ServerTypePIP:
-		cmd, err = g.buildPIPCommand(process)
-	case storage.ServerTypeCustom:
-		cmd, err = g.buildCustomCommand(process)
-	default:
-		return fmt.Errorf("unsupported server type: %s", process.Config.Type)
+	if err := g.initializeServer(running); err != nil {
+		return fmt.Errorf("failed to initialize server %s: %w", serverName, err)
+	}
+	return nil
+}
+
+// startProcess launches the server process. It reports false if the server was already running.
+func (g *Gateway) startProcess(serverName string) (*ServerProcess, bool, error) {
+	g.serversMux.RLock()
+	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
+	if !exists {
+		return nil, false, fmt.Errorf("server %s not found", serverName)
 	}
 
+	if process.IsRunning() {
+		log.Printf("Server %s is already running", serverName)
+		return process, false, nil // Not an error, just already running
+	}
+
+	// Resolving credentials may run secret commands or prompt for a passphrase,
+	// so the command is built before taking the lock every lookup needs
+	cmd, err := g.buildCommand(process)
 	if err != nil {
-		return fmt.Errorf("failed to build command: %w", err)
+		return nil, false, fmt.Errorf("failed to build command: %w", err)
 	}
 
-	// Set up environment variables
-	cmd.Env = os.Environ()
+	g.serversMux.Lock()
+	defer g.serversMux.Unlock()
 
-	// Load credentials and add them as environment variables
-	if creds, err := g.storage.LoadCredentials(serverName); err == nil {
-		for key, value := range creds.Data {
-			cmd.Env = append(cmd.Env, fmt.Sprintf("%s=%s", key, value))
-		}
+	if g.servers[serverName] != process {
+		return nil, false, fmt.Errorf("server %s was removed while starting", serverName)
+	}
+	if process.IsRunning() {
+		log.Printf("Server %s is already running", serverName)
+		return process, false, nil
 	}
 
+	// Run the server in its own process group so stopping it reaches its children too
+	setProcessGroup(cmd)
+
 	// Create pipes for stdin/stdout/stderr
 	stdin, err := cmd.StdinPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stdin pipe: %w", err)
+		return nil, false, fmt.Errorf("failed to create stdin pipe: %w", err)
 	}
 
 	stdout, err := cmd.StdoutPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stdout pipe: %w", err)
+		return nil, false, fmt.Errorf("failed to create stdout pipe: %w", err)
 	}
 
 	stderr, err := cmd.StderrPipe()
 	if err != nil {
-		return fmt.Errorf("failed to create stderr pipe: %w", err)
+		return nil, false, fmt.Errorf("failed to create stderr pipe: %w", err)
 	}
 
 	process.Cmd = cmd
@@ -235,89 +379,310 @@ func (g *Gateway) StartServer(serverName string) error {
 	process.Stdout = stdout
 	process.Stderr = stderr
 
+	// Output is kept in the server's log file; without one it goes to the gateway log
+	logWriter, err := logs.NewWriter(g.storage.GetLogPath(serverName), g.config.Logs)
+	if err != nil {
+		log.Printf("Failed to open log file for server %s: %v", serverName, err)
+	}
+	logLine := func(stream, line string) {
+		if logWriter == nil || logWriter.WriteLine(stream, line) != nil {
+			log.Printf("MCP server %s %s: %s", serverName, stream, strings.TrimRight(line, "\r\n"))
+		}
+	}
+
+	conn := newStdioConn(serverName, stdin, stdout, func(line string) { logLine(logs.StreamStdout, line) })
+	sess := newSession(serverName, conn, process.dispatchNotification, process.dispatchRequest)
+	process.attachSession(sess)
+
 	// Start the process
-	log.Printf("Starting server %s with command: %s %v", serverName, cmd.Path, cmd.Args[1:])
+	log.Printf("Starting server %s with command: %s", serverName, describeCommand(process.Config))
 	if err := cmd.Start(); err != nil {
-		return fmt.Errorf("failed to start server %s: %w", serverName, err)
+		if logWriter != nil {
+			logWriter.Close()
+		}
+		sess.close()
+		process.clientMux.Lock()
+		process.session = nil
+		process.clientMux.Unlock()
+		process.setHealth("")
+		return nil, false, fmt.Errorf("failed to start server %s: %w", serverName, err)
 	}
+	logLine(logs.StreamGateway, fmt.Sprintf("started (PID %d)", cmd.Process.Pid))
+
+	process.restart.mu.Lock()
+	process.restart.stderrTail = nil
+	process.restart.mu.Unlock()
 
+	exited := make(chan struct{})
 	process.runningMux.Lock()
 	process.running = true
+	process.stopped = false
+	process.exited = exited
 	process.runningMux.Unlock()
 
 	log.Printf("Started MCP server: %s (PID: %d)", serverName, cmd.Process.Pid)
 
 	// Start goroutine to monitor the process
 	go func() {
-		// Read stderr to capture any error output
-		stderrBytes, _ := io.ReadAll(process.Stderr)
-		if len(stderrBytes) > 0 {
-			log.Printf("MCP server %s stderr: %s", serverName, string(stderrBytes))
+		// Stream stderr into the log file as it arrives
+		scanner := bufio.NewScanner(stderr)
+		scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+		for scanner.Scan() {
+			logLine(logs.StreamStderr, scanner.Text())
+			process.recordStderr(scanner.Text())
 		}
+		io.Copy(io.Discard, stderr)
 
 		err := cmd.Wait()
 		process.runningMux.Lock()
 		process.running = false
 		process.runningMux.Unlock()
+		close(exited)
 
 		if err != nil {
 			log.Printf("MCP server %s exited with error: %v", serverName, err)
+			logLine(logs.StreamGateway, fmt.Sprintf("exited with error: %v", err))
 		} else {
 			log.Printf("MCP server %s exited normally", serverName)
+			logLine(logs.StreamGateway, "exited normally")
+		}
+		if logWriter != nil {
+			logWriter.Close()
 		}
+
+		sess.close()
+		g.sessionEnded(process, sess)
+		g.serverExited(process, cmd.ProcessState.ExitCode(), err != nil)
 	}()
 
+	return process, true, nil
+}
+
+// connectServer connects to a remote server in place of launching a process.
+// It reports false if the server was already connected.
+func (g *Gateway) connectServer(serverName string) (*ServerProcess, bool, error) {
+	g.serversMux.RLock()
+	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
+	if !exists {
+		return nil, false, fmt.Errorf("server %s not found", serverName)
+	}
+
+	if process.IsRunning() {
+		log.Printf("Server %s is already running", serverName)
+		return process, false, nil
+	}
+
+	// The connection lives as long as the session; only the connect itself is bounded
+	ctx, cancel := context.WithCancel(context.Background())
+	timer := time.AfterFunc(initializeTimeout, cancel)
+	conn, err := g.connectRemote(ctx, process)
+	timer.Stop()
+	if err != nil {
+		cancel()
+		return nil, false, err
+	}
+
+	sess := newSession(serverName, conn, process.dispatchNotification, process.dispatchRequest)
+	process.attachSession(sess)
+
+	process.runningMux.Lock()
+	process.running = true
+	process.stopped = false
+	process.runningMux.Unlock()
+
+	log.Printf("Connected to remote MCP server: %s (%s)", serverName, process.Config.URL)
+
+	go func() {
+		<-sess.done
+		cancel()
+
+		process.runningMux.Lock()
+		process.running = false
+		process.runningMux.Unlock()
+
+		log.Printf("Connection to remote MCP server %s closed: %v", serverName, sess.err)
+		g.sessionEnded(process, sess)
+		g.serverExited(process, -1, true)
+	}()
+
+	return process, true, nil
+}
+
+// attachSession makes sess the process's session. The known catalog stays listed
+// until the server's initialization replaces it.
+func (p *ServerProcess) attachSession(sess *session) {
+	p.clientMux.Lock()
+	defer p.clientMux.Unlock()
+
+	p.session = sess
+	p.initResult = nil
+
+	p.setHealth(HealthStarting)
+	p.touch()
+}
+
+// sessionEnded drops the catalog of a server whose session has ended. On-demand
+// servers keep listing theirs, since the next request starts them again, and so
+// do servers being restarted for a new client.
+func (g *Gateway) sessionEnded(process *ServerProcess, sess *session) {
+	keep := process.onDemand() || process.holding()
+
+	// A restart may already have replaced the session
+	process.clientMux.Lock()
+	current := process.session == sess
+	if current {
+		process.session = nil
+		if !keep {
+			process.tools = nil
+			process.resources = nil
+			process.templates = nil
+			process.prompts = nil
+		}
+	}
+	process.clientMux.Unlock()
+
+	if current {
+		process.setHealth("")
+	}
+	if !keep {
+		g.notifyCatalogChanged()
+	}
+}
+
+// dropCatalog forgets the catalog of a server that cannot be started, so clients
+// are not offered what nothing can serve
+func (g *Gateway) dropCatalog(process *ServerProcess) {
+	process.clientMux.Lock()
+	listed := len(process.tools)+len(process.resources)+len(process.templates)+len(process.prompts) > 0
+	process.tools = nil
+	process.resources = nil
+	process.templates = nil
+	process.prompts = nil
+	process.catalogKnown = false
+	process.clientMux.Unlock()
+
+	if listed {
+		g.notifyCatalogChanged()
+	}
+}
+
+// initializeServer runs the MCP handshake against a started server and caches its catalog
+func (g *Gateway) initializeServer(process *ServerProcess) error {
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
+
+	if err := process.Initialize(ctx, g.offerCapabilities(process)); err != nil {
+		return err
+	}
+	if g.reofferIfNeeded(process) {
+		return nil
+	}
+	if err := g.discoverCatalog(ctx, process); err != nil {
+		return err
+	}
+
+	g.restoreSubscriptions(ctx, process)
+
+	if sess := process.getSession(); sess != nil {
+		process.setHealth(HealthReady)
+		go g.monitorHealth(process, sess)
+	}
 	return nil
 }
 
-// buildNPMCommand builds the command for npm-based servers
-func (g *Gateway) buildNPMCommand(process *ServerProcess) (*exec.Cmd, error) {
-	cmdParts := strings.Fields(process.Config.Path)
-	if len(cmdParts) < 2 {
-		return nil, fmt.Errorf("invalid server path: %s", process.Config.Path)
+// discoverCatalog lists the tools, resources and prompts of an initialized server
+// and publishes them to the gateway's clients
+func (g *Gateway) discoverCatalog(ctx context.Context, process *ServerProcess) error {
+	caps := process.Capabilities()
+
+	var tools []*mcpsdk.Tool
+	if caps.Tools != nil {
+		var err error
+		if tools, err = process.ListTools(ctx); err != nil {
+			return err
+		}
 	}
 
-	// For filesystem server, we need to pass allowed directories
-	if strings.Contains(process.Config.Package, "filesystem") {
-		// Get allowed directories from credentials
-		allowedDirs := "/tmp" // default
-		if creds, err := g.storage.LoadCredentials(process.Name); err == nil {
-			if dirs, ok := creds.Data["ALLOWED_DIRECTORIES"]; ok && dirs != "" {
-				allowedDirs = dirs
-			}
+	var resources []*mcpsdk.Resource
+	var templates []*mcpsdk.ResourceTemplate
+	if caps.Resources != nil {
+		var err error
+		if resources, err = process.ListResources(ctx); err != nil {
+			return err
+		}
+		if templates, err = process.ListResourceTemplates(ctx); err != nil {
+			return err
 		}
+	}
+
+	var prompts []*mcpsdk.Prompt
+	if caps.Prompts != nil {
+		var err error
+		if prompts, err = process.ListPrompts(ctx); err != nil {
+			return err
+		}
+	}
 
-		// Add the allowed directory as an argument
-		args := append(cmdParts[1:], allowedDirs)
-		return exec.Command(cmdParts[0], args...), nil
+	process.clientMux.Lock()
+	// Entries that did not change are kept, so clients are not told about a change
+	tools, toolsChanged := reuseUnchanged(process.tools, tools, func(t *mcpsdk.Tool) string { return t.Name })
+	resources, resourcesChanged := reuseUnchanged(process.resources, resources, func(r *mcpsdk.Resource) string { return r.URI })
+	templates, templatesChanged := reuseUnchanged(process.templates, templates, func(t *mcpsdk.ResourceTemplate) string { return t.URITemplate })
+	prompts, promptsChanged := reuseUnchanged(process.prompts, prompts, func(p *mcpsdk.Prompt) string { return p.Name })
+	changed := !process.catalogKnown || toolsChanged || resourcesChanged || templatesChanged || promptsChanged
+
+	process.tools = tools
+	process.resources = resources
+	process.templates = templates
+	process.prompts = prompts
+	process.catalogKnown = true
+	process.clientMux.Unlock()
+
+	log.Printf("Discovered %d tools, %d resources, %d resource templates and %d prompts on server %s",
+		len(tools), len(resources), len(templates), len(prompts), process.Name)
+
+	if changed {
+		if err := g.saveCatalog(process); err != nil {
+			log.Printf("Failed to cache catalog of server %s: %v", process.Name, err)
+		}
 	}
 
-	// For other npm servers, just run the command
-	return exec.Command(cmdParts[0], cmdParts[1:]...), nil
+	g.notifyCatalogChanged()
+	return nil
 }
 
-// buildPIPCommand builds the command for pip-based servers
-func (g *Gateway) buildPIPCommand(process *ServerProcess) (*exec.Cmd, error) {
-	// For pip servers, the path should be the python command
-	return exec.Command("python3", process.Config.Path), nil
+// refreshCatalog rediscovers the catalog of a server that reported a change to it
+func (g *Gateway) refreshCatalog(process *ServerProcess) {
+	ctx, cancel := context.WithTimeout(context.Background(), initializeTimeout)
+	defer cancel()
+
+	if err := g.discoverCatalog(ctx, process); err != nil {
+		log.Printf("Failed to refresh catalog of server %s: %v", process.Name, err)
+	}
 }
 
-// buildCustomCommand builds the command for custom servers
-func (g *Gateway) buildCustomCommand(process *ServerProcess) (*exec.Cmd, error) {
-	// For custom servers, parse the path as command + args
-	cmdParts := strings.Fields(process.Config.Path)
-	if len(cmdParts) == 0 {
-		return nil, fmt.Errorf("invalid custom server path: %s", process.Config.Path)
+// restoreSubscriptions re-subscribes a restarted server to the resources clients are watching
+func (g *Gateway) restoreSubscriptions(ctx context.Context, process *ServerProcess) {
+	g.subscriptionsMux.Lock()
+	defer g.subscriptionsMux.Unlock()
+
+	for uri := range g.subscriptions {
+		serverName, original, ok := ParseResourceURI(uri)
+		if !ok || serverName != process.Name {
+			continue
+		}
+		if err := process.Subscribe(ctx, original); err != nil {
+			log.Printf("Failed to restore subscription to %s on server %s: %v", original, process.Name, err)
+		}
 	}
-	return exec.Command(cmdParts[0], cmdParts[1:]...), nil
 }
 
-// StopServer stops a specific MCP server
+// StopServer stops a specific MCP server and waits for it to exit
 func (g *Gateway) StopServer(serverName string) error {
-	g.serversMux.Lock()
-	defer g.serversMux.Unlock()
-
+	g.serversMux.RLock()
 	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
 	if !exists {
 		return fmt.Errorf("server %s not found", serverName)
 	}
@@ -326,22 +691,549 @@ func (g *Gateway) StopServer(serverName string) error {
 		return fmt.Errorf("server %s is not running", serverName)
 	}
 
-	// Send interrupt signal
-	if err := process.Cmd.Process.Signal(os.Interrupt); err != nil {
-		// If interrupt fails, try to kill the process
-		if killErr := process.Cmd.Process.Kill(); killErr != nil {
-			return fmt.Errorf("failed to stop server %s: interrupt failed (%v), kill failed (%v)", serverName, err, killErr)
-		}
-	}
-
+	// Mark the stop first so the exit is not taken for a crash
 	process.runningMux.Lock()
-	process.running = false
+	process.stopped = true
 	process.runningMux.Unlock()
 
+	if process.Config.Type == storage.ServerTypeRemote {
+		// Closing the session disconnects from the remote server
+		if session := process.getSession(); session != nil {
+			session.close()
+		}
+		process.runningMux.Lock()
+		process.running = false
+		process.runningMux.Unlock()
+	} else if err := process.stop(); err != nil {
+		return fmt.Errorf("failed to stop server %s: %w", serverName, err)
+	}
+
 	log.Printf("Stopped MCP server: %s", serverName)
 	return nil
 }
 
+// stop shuts down the server process and everything it spawned. Closing stdin
+// asks the server to exit; if it does not within the grace period its process
+// group is sent SIGTERM, and after another grace period SIGKILL. Processes the
+// server started that outlive it are ended the same way.
+func (p *ServerProcess) stop() error {
+	p.runningMux.RLock()
+	cmd, stdin, exited := p.Cmd, p.Stdin, p.exited
+	p.runningMux.RUnlock()
+
+	grace := configDuration(p.Config, "stop_grace_period", p.Config.StopGracePeriod, defaultStopGracePeriod)
+
+	stdin.Close()
+	if !waitExited(exited, grace) {
+		log.Printf("Server %s did not exit within %s of closing stdin, sending SIGTERM", p.Name, grace)
+		if err := terminateGroup(cmd.Process); err != nil {
+			log.Printf("Failed to send SIGTERM to server %s: %v", p.Name, err)
+		}
+		if !waitExited(exited, grace) {
+			log.Printf("Server %s did not exit within %s of SIGTERM, sending SIGKILL", p.Name, grace)
+			if err := killGroup(cmd.Process); err != nil {
+				return fmt.Errorf("kill failed: %w", err)
+			}
+			if !waitExited(exited, grace) {
+				return fmt.Errorf("process %d did not exit after SIGKILL", cmd.Process.Pid)
+			}
+		}
+	}
+
+	return p.endGroup(cmd.Process, grace)
+}
+
+// endGroup ends the processes left in the process group of an exited server,
+// such as ones that detached from its pipes
+func (p *ServerProcess) endGroup(process *os.Process, grace time.Duration) error {
+	if !groupAlive(process) {
+		return nil
+	}
+
+	log.Printf("Processes started by server %s outlived it, sending SIGTERM", p.Name)
+	if err := terminateGroup(process); err != nil {
+		log.Printf("Failed to send SIGTERM to the processes of server %s: %v", p.Name, err)
+	}
+	if waitGroupExited(process, grace) {
+		return nil
+	}
+
+	log.Printf("Processes started by server %s did not exit within %s of SIGTERM, sending SIGKILL", p.Name, grace)
+	if err := killGroup(process); err != nil {
+		return fmt.Errorf("kill failed: %w", err)
+	}
+	if !waitGroupExited(process, grace) {
+		// Killed processes nobody reaps stay in the group as zombies; the server
+		// itself is stopped either way
+		log.Printf("Processes started by server %s are still in its process group after SIGKILL", p.Name)
+	}
+	return nil
+}
+
+// waitGroupExited waits up to timeout for the process group led by process to be empty
+func waitGroupExited(process *os.Process, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for groupAlive(process) {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return true
+}
+
+// waitExited waits up to timeout for exited to be closed
+func waitExited(exited <-chan struct{}, timeout time.Duration) bool {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-exited:
+		return true
+	case <-timer.C:
+		return false
+	}
+}
+
+// AddServer loads a newly installed server and starts it, unless it starts on first use
+func (g *Gateway) AddServer(serverName string) error {
+	serverConfig, err := g.storage.LoadServerConfig(serverName)
+	if err != nil {
+		return err
+	}
+	serverName = serverConfig.Name // normalized
+	g.migrateFilesystemArgs(serverConfig)
+
+	process := &ServerProcess{
+		Name:           serverConfig.Name,
+		Config:         serverConfig,
+		onNotification: g.handleNotification,
+		onRequest:      g.handleRequest,
+	}
+	g.loadCatalog(process)
+
+	g.serversMux.Lock()
+	if _, exists := g.servers[serverName]; exists {
+		g.serversMux.Unlock()
+		return fmt.Errorf("server %s is already loaded", serverName)
+	}
+	g.servers[serverName] = process
+	g.serversMux.Unlock()
+
+	log.Printf("Added MCP server: %s", serverName)
+	g.notifyCatalogChanged()
+
+	if process.onDemand() {
+		return nil
+	}
+	if err := g.StartServer(serverName); err != nil {
+		if !process.IsRunning() {
+			g.scheduleRestart(process, true)
+		}
+		return err
+	}
+	return nil
+}
+
+// RemoveServer stops a server, forgets it and deletes its configuration and credentials
+func (g *Gateway) RemoveServer(serverName string) error {
+	g.serversMux.RLock()
+	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
+	if !exists {
+		return fmt.Errorf("server %s not found", serverName)
+	}
+
+	if process.IsRunning() {
+		if err := g.StopServer(serverName); err != nil {
+			return err
+		}
+	}
+
+	g.serversMux.Lock()
+	delete(g.servers, serverName)
+	g.serversMux.Unlock()
+
+	g.subscriptionsMux.Lock()
+	for uri := range g.subscriptions {
+		if name, _, ok := ParseResourceURI(uri); ok && name == serverName {
+			delete(g.subscriptions, uri)
+		}
+	}
+	g.subscriptionsMux.Unlock()
+
+	if err := g.storage.DeleteServerConfig(serverName); err != nil {
+		return err
+	}
+	if err := g.storage.DeleteCredentials(serverName); err != nil {
+		return err
+	}
+
+	log.Printf("Removed MCP server: %s", serverName)
+	g.notifyCatalogChanged()
+	return nil
+}
+
+// ToolInfo describes a tool exposed by one of the gateway's servers
+type ToolInfo struct {
+	Name   string // Name exposed to gateway clients
+	Server string
+	Tool   *mcpsdk.Tool
+}
+
+// ListTools returns the tools of every initialized server under their exposed names
+func (g *Gateway) ListTools() []*ToolInfo {
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	var result []*ToolInfo
+	for name, process := range g.servers {
+		process.clientMux.RLock()
+		for _, tool := range process.tools {
+			result = append(result, &ToolInfo{
+				Name:   g.namer.Name(process.Config, tool.Name),
+				Server: name,
+				Tool:   tool,
+			})
+		}
+		process.clientMux.RUnlock()
+	}
+
+	return result
+}
+
+// CallTool forwards a tool call, addressed by its exposed name, to the server that owns the tool
+func (g *Gateway) CallTool(ctx context.Context, name string, args json.RawMessage) (*mcpsdk.CallToolResult, error) {
+	process, toolName, err := g.resolveName(name, (*ServerProcess).hasTool)
+	if err != nil {
+		return nil, fmt.Errorf("no server provides tool %s", name)
+	}
+
+	var result *mcpsdk.CallToolResult
+	err = g.forward(ctx, process, toolName, func(ctx context.Context) error {
+		result, err = process.CallTool(ctx, toolName, args)
+		return err
+	})
+	return result, err
+}
+
+// resolveName maps an exposed tool or prompt name back to its server and downstream name.
+// Unprefixed servers are resolved by checking whether they provide the name.
+func (g *Gateway) resolveName(name string, provides func(*ServerProcess, string) bool) (*ServerProcess, string, error) {
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	configs := make([]*storage.ServerConfig, 0, len(g.servers))
+	for _, process := range g.servers {
+		configs = append(configs, process.Config)
+	}
+
+	if serverConfig, downstream, ok := g.namer.Resolve(configs, name); ok {
+		return g.servers[serverConfig.Name], downstream, nil
+	}
+
+	for _, process := range g.servers {
+		if g.namer.Prefix(process.Config) != "" {
+			continue
+		}
+		if provides(process, name) {
+			return process, name, nil
+		}
+	}
+
+	return nil, "", fmt.Errorf("%s not found", name)
+}
+
+// PromptInfo describes a prompt exposed by one of the gateway's servers
+type PromptInfo struct {
+	Name   string // Name exposed to gateway clients
+	Server string
+	Prompt *mcpsdk.Prompt
+}
+
+// ListPrompts returns the prompts of every initialized server under their exposed names
+func (g *Gateway) ListPrompts() []*PromptInfo {
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	var result []*PromptInfo
+	for name, process := range g.servers {
+		process.clientMux.RLock()
+		for _, prompt := range process.prompts {
+			result = append(result, &PromptInfo{
+				Name:   g.namer.Name(process.Config, prompt.Name),
+				Server: name,
+				Prompt: prompt,
+			})
+		}
+		process.clientMux.RUnlock()
+	}
+
+	return result
+}
+
+// GetPrompt renders a prompt, addressed by its exposed name, on the server that owns it
+func (g *Gateway) GetPrompt(ctx context.Context, name string, args map[string]string) (*mcpsdk.GetPromptResult, error) {
+	process, promptName, err := g.resolveName(name, (*ServerProcess).hasPrompt)
+	if err != nil {
+		return nil, fmt.Errorf("no server provides prompt %s", name)
+	}
+
+	var result *mcpsdk.GetPromptResult
+	err = g.forward(ctx, process, "", func(ctx context.Context) error {
+		result, err = process.GetPrompt(ctx, promptName, args)
+		return err
+	})
+	return result, err
+}
+
+// Complete forwards an argument completion request to the server owning the referenced
+// prompt or resource template
+func (g *Gateway) Complete(ctx context.Context, params *mcpsdk.CompleteParams) (*mcpsdk.CompleteResult, error) {
+	if params.Ref == nil {
+		return nil, fmt.Errorf("completion reference is required")
+	}
+
+	forwarded := *params
+	ref := *params.Ref
+	forwarded.Ref = &ref
+
+	var process *ServerProcess
+	var err error
+	switch ref.Type {
+	case "ref/prompt":
+		process, ref.Name, err = g.resolveName(ref.Name, (*ServerProcess).hasPrompt)
+		if err != nil {
+			return nil, fmt.Errorf("no server provides prompt %s", params.Ref.Name)
+		}
+	case "ref/resource":
+		process, ref.URI, err = g.resolveResource(ref.URI)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("unsupported completion reference type %s", ref.Type)
+	}
+	var result *mcpsdk.CompleteResult
+	err = g.forward(ctx, process, "", func(ctx context.Context) error {
+		if process.Capabilities().Completions == nil {
+			// Servers without completion support simply have no suggestions
+			result = &mcpsdk.CompleteResult{Completion: mcpsdk.CompletionResultDetails{Values: []string{}}}
+			return nil
+		}
+		result, err = process.Complete(ctx, &forwarded)
+		return err
+	})
+	return result, err
+}
+
+// ResourceInfo describes a resource exposed by one of the gateway's servers
+type ResourceInfo struct {
+	URI      string // URI exposed to gateway clients
+	Server   string
+	Resource *mcpsdk.Resource
+}
+
+// ResourceTemplateInfo describes a resource template exposed by one of the gateway's servers
+type ResourceTemplateInfo struct {
+	URITemplate string // URI template exposed to gateway clients
+	Server      string
+	Template    *mcpsdk.ResourceTemplate
+}
+
+// ListResources returns the resources of every initialized server under their exposed URIs
+func (g *Gateway) ListResources() []*ResourceInfo {
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	var result []*ResourceInfo
+	for name, process := range g.servers {
+		process.clientMux.RLock()
+		for _, resource := range process.resources {
+			result = append(result, &ResourceInfo{
+				URI:      ResourceURI(name, resource.URI),
+				Server:   name,
+				Resource: resource,
+			})
+		}
+		process.clientMux.RUnlock()
+	}
+
+	return result
+}
+
+// ListResourceTemplates returns the resource templates of every initialized server
+func (g *Gateway) ListResourceTemplates() []*ResourceTemplateInfo {
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	var result []*ResourceTemplateInfo
+	for name, process := range g.servers {
+		process.clientMux.RLock()
+		for _, template := range process.templates {
+			result = append(result, &ResourceTemplateInfo{
+				URITemplate: ResourceURI(name, template.URITemplate),
+				Server:      name,
+				Template:    template,
+			})
+		}
+		process.clientMux.RUnlock()
+	}
+
+	return result
+}
+
+// ReadResource reads a resource, addressed by its exposed URI, from the server that owns it.
+// URIs in the returned contents are rewritten to their exposed form.
+func (g *Gateway) ReadResource(ctx context.Context, uri string) (*mcpsdk.ReadResourceResult, error) {
+	process, original, err := g.resolveResource(uri)
+	if err != nil {
+		return nil, err
+	}
+	var result *mcpsdk.ReadResourceResult
+	err = g.forward(ctx, process, "", func(ctx context.Context) error {
+		result, err = process.ReadResource(ctx, original)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, contents := range result.Contents {
+		if contents.URI != "" {
+			contents.URI = ResourceURI(process.Name, contents.URI)
+		}
+	}
+	return result, nil
+}
+
+// SubscribeResource subscribes to updates of a resource. The owning server is
+// only asked to subscribe for the first subscriber.
+func (g *Gateway) SubscribeResource(ctx context.Context, uri string) error {
+	process, original, err := g.resolveResource(uri)
+	if err != nil {
+		return err
+	}
+	if err := g.activate(process); err != nil {
+		return err
+	}
+
+	g.subscriptionsMux.Lock()
+	defer g.subscriptionsMux.Unlock()
+
+	if g.subscriptions[uri] == 0 {
+		if caps := process.Capabilities(); caps.Resources == nil || !caps.Resources.Subscribe {
+			return fmt.Errorf("server %s does not support resource subscriptions", process.Name)
+		}
+		if err := process.Subscribe(ctx, original); err != nil {
+			return err
+		}
+	}
+	g.subscriptions[uri]++
+	return nil
+}
+
+// UnsubscribeResource drops a subscription. The owning server is asked to
+// unsubscribe once the last subscriber is gone.
+func (g *Gateway) UnsubscribeResource(ctx context.Context, uri string) error {
+	process, original, err := g.resolveResource(uri)
+	if err != nil {
+		return err
+	}
+
+	g.subscriptionsMux.Lock()
+	defer g.subscriptionsMux.Unlock()
+
+	if g.subscriptions[uri] == 0 {
+		return nil
+	}
+	g.subscriptions[uri]--
+	if g.subscriptions[uri] > 0 {
+		return nil
+	}
+
+	delete(g.subscriptions, uri)
+	return process.Unsubscribe(ctx, original)
+}
+
+// resolveResource maps an exposed resource URI back to its server and original URI
+func (g *Gateway) resolveResource(uri string) (*ServerProcess, string, error) {
+	serverName, original, ok := ParseResourceURI(uri)
+	if !ok {
+		return nil, "", fmt.Errorf("invalid resource URI %s", uri)
+	}
+
+	g.serversMux.RLock()
+	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
+
+	if !exists {
+		return nil, "", fmt.Errorf("server %s not found", serverName)
+	}
+	return process, original, nil
+}
+
+// handleNotification processes notifications sent by a server
+func (g *Gateway) handleNotification(process *ServerProcess, method string, params json.RawMessage) {
+	switch method {
+	case "notifications/resources/updated":
+		var updated mcpsdk.ResourceUpdatedNotificationParams
+		if err := json.Unmarshal(params, &updated); err != nil {
+			log.Printf("Invalid %s notification from server %s: %v", method, process.Name, err)
+			return
+		}
+		g.notifyResourceUpdated(ResourceURI(process.Name, updated.URI))
+
+	case "notifications/progress":
+		var progress mcpsdk.ProgressNotificationParams
+		if err := json.Unmarshal(params, &progress); err != nil {
+			log.Printf("Invalid %s notification from server %s: %v", method, process.Name, err)
+			return
+		}
+		g.routeProgress(process, &progress)
+
+	case "notifications/tools/list_changed", "notifications/resources/list_changed", "notifications/prompts/list_changed":
+		// Listing waits on the server's replies, which arrive on the goroutine delivering this notification
+		go g.refreshCatalog(process)
+	}
+}
+
+// OnResourceUpdated registers a function called when a subscribed resource changes
+func (g *Gateway) OnResourceUpdated(fn func(uri string)) {
+	g.listenersMux.Lock()
+	defer g.listenersMux.Unlock()
+	g.resourceListeners = append(g.resourceListeners, fn)
+}
+
+// notifyResourceUpdated invokes every registered resource listener
+func (g *Gateway) notifyResourceUpdated(uri string) {
+	g.listenersMux.Lock()
+	listeners := append([]func(string){}, g.resourceListeners...)
+	g.listenersMux.Unlock()
+
+	for _, fn := range listeners {
+		fn(uri)
+	}
+}
+
+// OnCatalogChange registers a function called whenever the set of available tools or resources changes
+func (g *Gateway) OnCatalogChange(fn func()) {
+	g.listenersMux.Lock()
+	defer g.listenersMux.Unlock()
+	g.listeners = append(g.listeners, fn)
+}
+
+// notifyCatalogChanged invokes every registered catalog listener
+func (g *Gateway) notifyCatalogChanged() {
+	g.listenersMux.Lock()
+	listeners := append([]func(){}, g.listeners...)
+	g.listenersMux.Unlock()
+
+	for _, fn := range listeners {
+		fn()
+	}
+}
+
 // IsServerRunning checks if a server is running
 func (g *Gateway) IsServerRunning(serverName string) bool {
 	g.serversMux.RLock()
@@ -362,12 +1254,22 @@ func (g *Gateway) ListServers() map[string]*ServerInfo {
 
 	result := make(map[string]*ServerInfo)
 	for name, process := range g.servers {
+		exitCode, lastError, restarts := process.exitInfo()
+		health, latency, failures := process.Health()
 		result[name] = &ServerInfo{
-			Name:    name,
-			Type:    string(process.Config.Type),
-			Version: process.Config.Version,
-			Status:  g.getServerStatus(name),
-			Path:    process.Config.Path,
+			Name:      name,
+			Type:      string(process.Config.Type),
+			Version:   process.Config.Version,
+			Status:    process.status(),
+			Path:      process.Config.Path,
+			URL:       process.Config.URL,
+			ExitCode:  exitCode,
+			LastError: lastError,
+			Restarts:  restarts,
+
+			Health:       health,
+			LatencyMs:    float64(latency.Microseconds()) / 1000,
+			PingFailures: failures,
 		}
 	}
 
@@ -381,21 +1283,52 @@ type ServerInfo struct {
 	Version string `json:"version"`
 	Status  string `json:"status"`
 	Path    string `json:"path"`
+	URL     string `json:"url,omitempty"`
+
+	// Details of the last exit, and the automatic restarts within the restart window
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	LastError string `json:"last_error,omitempty"` // tail of stderr
+	Restarts  int    `json:"restarts,omitempty"`
+
+	// Protocol-level health of a running server, from periodic pings
+	Health       string  `json:"health,omitempty"`
+	LatencyMs    float64 `json:"latency_ms,omitempty"`
+	PingFailures int     `json:"ping_failures,omitempty"`
 }
 
-// getServerStatus returns the current status of a server
-func (g *Gateway) getServerStatus(serverName string) string {
-	if g.IsServerRunning(serverName) {
+// status returns the current status of the server. It takes no gateway lock, so
+// ListServers can call it while holding serversMux.
+func (p *ServerProcess) status() string {
+	if p.IsRunning() {
 		return "running"
 	}
+	if p.Crashed() {
+		return string(storage.StatusError)
+	}
+	if p.onDemand() {
+		// Down, but started by the next request that needs it
+		return "idle"
+	}
 	return "stopped"
 }
 
+// StoppedOnRequest reports whether the server was stopped through StopServer
+func (p *ServerProcess) StoppedOnRequest() bool {
+	p.runningMux.RLock()
+	defer p.runningMux.RUnlock()
+	return p.stopped
+}
+
 // IsRunning returns true if the process is running
 func (p *ServerProcess) IsRunning() bool {
 	p.runningMux.RLock()
 	defer p.runningMux.RUnlock()
 
+	// Remote servers are running for as long as their connection is open
+	if p.Config.Type == storage.ServerTypeRemote {
+		return p.running
+	}
+
 	if !p.running || p.Cmd == nil || p.Cmd.Process == nil {
 		return false
 	}
@@ -403,34 +1336,3 @@ func (p *ServerProcess) IsRunning() bool {
 	// Check if the process is actually still running
 	return p.Cmd.Process.Signal(syscall.Signal(0)) == nil
 }
-
-// SendMessage sends a message to the server process
-func (p *ServerProcess) SendMessage(message interface{}) error {
-	if !p.IsRunning() {
-		return fmt.Errorf("server %s is not running", p.Name)
-	}
-
-	data, err := json.Marshal(message)
-	if err != nil {
-		return fmt.Errorf("failed to marshal message: %w", err)
-	}
-
-	_, err = p.Stdin.Write(append(data, '\n'))
-	return err
-}
-
-// ReceiveMessage receives a message from the server process
-func (p *ServerProcess) ReceiveMessage() ([]byte, error) {
-	if !p.IsRunning() {
-		return nil, fmt.Errorf("server %s is not running", p.Name)
-	}
-
-	// Read line from stdout
-	buf := make([]byte, 1024)
-	n, err := p.Stdout.Read(buf)
-	if err != nil {
-		return nil, err
-	}
-
-	return buf[:n], nil
-}
\ No newline at end of file
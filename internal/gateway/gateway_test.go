@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// blockingProvider resolves secrets only once released, like a secret command
+// waiting for a password manager
+type blockingProvider struct {
+	resolving chan struct{}
+	release   chan struct{}
+}
+
+func (p *blockingProvider) Resolve(ref string) (string, error) {
+	p.resolving <- struct{}{}
+	<-p.release
+	return "secret", nil
+}
+
+func TestStartResolvesCredentialsOutsideLock(t *testing.T) {
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	provider := &blockingProvider{resolving: make(chan struct{}), release: make(chan struct{})}
+	store.RegisterSecretProvider("slow", provider)
+
+	for _, name := range []string{"slow", "other"} {
+		if err := store.SaveServerConfig(&storage.ServerConfig{
+			Name:          name,
+			Command:       filepath.Join(t.TempDir(), "missing"),
+			RestartPolicy: storage.RestartNever,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SaveCredentials("slow", &storage.Credential{Refs: map[string]string{"TOKEN": "slow:token"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	started := make(chan error, 1)
+	go func() {
+		started <- gw.StartServer("slow")
+	}()
+	<-provider.resolving
+
+	// Lookups and other servers carry on while the credentials resolve
+	listed := make(chan struct{})
+	go func() {
+		gw.ListTools()
+		gw.ListServers()
+		gw.StartServer("other")
+		close(listed)
+	}()
+	select {
+	case <-listed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the gateway was locked while credentials resolved")
+	}
+
+	close(provider.release)
+	if err := <-started; err == nil {
+		t.Error("StartServer succeeded without an executable")
+	}
+}
@@ -0,0 +1,131 @@
+package gateway
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// Health states of a running server
+const (
+	HealthStarting     = "starting"     // launched, handshake not finished
+	HealthReady        = "ready"        // answering pings
+	HealthDegraded     = "degraded"     // recent pings failed
+	HealthUnresponsive = "unresponsive" // too many failed pings; being restarted
+)
+
+// Health check defaults, used when a server's configuration does not set them
+const (
+	defaultHealthCheckInterval = 30 * time.Second
+	defaultHealthCheckTimeout  = 10 * time.Second
+	defaultUnhealthyThreshold  = 3
+)
+
+// healthState tracks the protocol-level health of a server
+type healthState struct {
+	state    string
+	latency  time.Duration // round trip of the last successful ping
+	failures int           // consecutive failed pings
+	mu       sync.Mutex
+}
+
+// setHealth replaces the health state, clearing the ping history
+func (p *ServerProcess) setHealth(state string) {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+
+	p.health.state = state
+	p.health.latency = 0
+	p.health.failures = 0
+}
+
+// Health returns the server's health state, last ping latency and consecutive ping failures
+func (p *ServerProcess) Health() (string, time.Duration, int) {
+	p.health.mu.Lock()
+	defer p.health.mu.Unlock()
+	return p.health.state, p.health.latency, p.health.failures
+}
+
+// monitorHealth pings a server over sess until the session ends. A server that
+// fails too many pings in a row is killed, so its restart policy brings it back.
+func (g *Gateway) monitorHealth(process *ServerProcess, sess *session) {
+	interval := configDuration(process.Config, "health_check_interval", process.Config.HealthCheckInterval, defaultHealthCheckInterval)
+	if interval <= 0 {
+		return
+	}
+	timeout := configDuration(process.Config, "health_check_timeout", process.Config.HealthCheckTimeout, defaultHealthCheckTimeout)
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	threshold := process.Config.UnhealthyThreshold
+	if threshold <= 0 {
+		threshold = defaultUnhealthyThreshold
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-sess.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		start := time.Now()
+		err := sess.call(ctx, "ping", struct{}{}, nil)
+		cancel()
+
+		process.health.mu.Lock()
+		if err == nil {
+			process.health.state = HealthReady
+			process.health.latency = time.Since(start)
+			process.health.failures = 0
+			process.health.mu.Unlock()
+			continue
+		}
+
+		process.health.failures++
+		failures := process.health.failures
+		if failures >= threshold {
+			process.health.state = HealthUnresponsive
+		} else {
+			process.health.state = HealthDegraded
+		}
+		process.health.mu.Unlock()
+
+		log.Printf("Health check of server %s failed (%d/%d): %v", process.Name, failures, threshold, err)
+		if failures >= threshold {
+			log.Printf("Server %s is unresponsive, restarting it", process.Name)
+			g.kill(process, sess)
+			return
+		}
+	}
+}
+
+// kill forcibly ends the server behind sess: local process groups are killed and
+// remote connections closed. Either way the server's exit handling takes over.
+// A server that was stopped or restarted meanwhile has moved on from sess and is
+// left alone.
+func (g *Gateway) kill(process *ServerProcess, sess *session) {
+	// Starting a server replaces its command and session under the lock
+	g.serversMux.RLock()
+	defer g.serversMux.RUnlock()
+
+	if process.getSession() != sess {
+		return
+	}
+
+	cmd := process.Cmd
+	if process.Config.Type != storage.ServerTypeRemote && cmd != nil && cmd.Process != nil {
+		if err := killGroup(cmd.Process); err != nil {
+			log.Printf("Failed to kill server %s: %v", process.Name, err)
+		}
+		return
+	}
+	sess.close()
+}
@@ -0,0 +1,99 @@
+package gateway
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+)
+
+// answerPing has the child answer the next ping, failing it if fail is set
+func (c *fakeChild) answerPing(fail bool) {
+	c.t.Helper()
+	req := c.readRequest("ping")
+	if fail {
+		c.write(fmt.Sprintf(`{"jsonrpc":"2.0","id":%v,"error":{"code":-32603,"message":"busy"}}`, req.ID.Raw()))
+		return
+	}
+	c.write(&jsonrpc.Response{ID: req.ID, Result: []byte(`{}`)})
+}
+
+// waitForHealth waits until the server reports state after failures failed pings
+func waitForHealth(t *testing.T, process *ServerProcess, state string, failures int) {
+	t.Helper()
+	waitFor(t, fmt.Sprintf("health %s after %d failures", state, failures), func() bool {
+		got, _, gotFailures := process.Health()
+		return got == state && gotFailures == failures
+	})
+}
+
+func TestHealthMonitorThresholds(t *testing.T) {
+	g, process, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{
+		Name:                "github",
+		HealthCheckInterval: "10ms",
+		HealthCheckTimeout:  "5s",
+		UnhealthyThreshold:  3,
+	})
+	sess := process.getSession()
+	monitored := make(chan struct{})
+	go func() {
+		g.monitorHealth(process, sess)
+		close(monitored)
+	}()
+
+	child.answerPing(false)
+	waitForHealth(t, process, HealthReady, 0)
+	if _, latency, _ := process.Health(); latency <= 0 {
+		t.Errorf("latency of an answered ping = %v; want it measured", latency)
+	}
+
+	// Failures below the threshold degrade the server; an answered ping clears them
+	child.answerPing(true)
+	waitForHealth(t, process, HealthDegraded, 1)
+	child.answerPing(true)
+	waitForHealth(t, process, HealthDegraded, 2)
+	child.answerPing(false)
+	waitForHealth(t, process, HealthReady, 0)
+
+	for i := 1; i < 3; i++ {
+		child.answerPing(true)
+		waitForHealth(t, process, HealthDegraded, i)
+	}
+	child.answerPing(true)
+	waitForHealth(t, process, HealthUnresponsive, 3)
+
+	// The unresponsive server is killed, which ends its session and the monitor
+	<-monitored
+	select {
+	case <-sess.done:
+	default:
+		t.Error("session of an unresponsive server is still open")
+	}
+}
+
+func TestKillLeavesRestartedServerAlone(t *testing.T) {
+	g, process, _ := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	old := process.getSession()
+
+	// A restart has replaced the session the monitor was watching
+	current, _ := newPipeSession(t, process.dispatchNotification, process.dispatchRequest)
+	process.attachSession(current)
+
+	g.kill(process, old)
+	select {
+	case <-old.done:
+		t.Error("kill closed the session it no longer owns")
+	case <-current.done:
+		t.Error("kill closed the session of the restarted server")
+	default:
+	}
+
+	g.kill(process, current)
+	select {
+	case <-current.done:
+	default:
+		t.Error("kill left the current session open")
+	}
+}
@@ -0,0 +1,101 @@
+package gateway
+
+import (
+	"strings"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// ToolPrefixKey is the ServerConfig.Config key overriding the prefix of a server's tools.
+// An empty string exposes the server's tools without a prefix.
+const ToolPrefixKey = "tool_prefix"
+
+// ToolNamer maps downstream tool names to the names exposed by the gateway and back
+type ToolNamer struct {
+	prefixed  bool
+	separator string
+}
+
+// NewToolNamer creates a namer from the gateway configuration
+func NewToolNamer(cfg config.GatewayConfig) *ToolNamer {
+	separator := cfg.ToolSeparator
+	if separator == "" {
+		separator = config.DefaultToolSeparator
+	}
+
+	return &ToolNamer{
+		prefixed:  cfg.ToolNaming != config.ToolNamingNone,
+		separator: separator,
+	}
+}
+
+// Prefix returns the prefix applied to the tools of a server
+func (n *ToolNamer) Prefix(server *storage.ServerConfig) string {
+	if !n.prefixed {
+		return ""
+	}
+
+	if value, ok := server.Config[ToolPrefixKey]; ok {
+		if prefix, ok := value.(string); ok {
+			return prefix
+		}
+	}
+	return server.Name
+}
+
+// Name returns the exposed name of a server's tool
+func (n *ToolNamer) Name(server *storage.ServerConfig, tool string) string {
+	prefix := n.Prefix(server)
+	if prefix == "" {
+		return tool
+	}
+	return prefix + n.separator + tool
+}
+
+// Resolve returns the server and downstream tool name for a prefixed exposed name,
+// preferring the longest matching prefix. Tools of unprefixed servers cannot be
+// resolved from the name alone and report false.
+func (n *ToolNamer) Resolve(servers []*storage.ServerConfig, name string) (*storage.ServerConfig, string, bool) {
+	var match *storage.ServerConfig
+	var matchPrefix string
+
+	for _, server := range servers {
+		prefix := n.Prefix(server)
+		if prefix == "" {
+			continue
+		}
+		if strings.HasPrefix(name, prefix+n.separator) && len(prefix) > len(matchPrefix) {
+			match = server
+			matchPrefix = prefix
+		}
+	}
+
+	if match == nil {
+		return nil, "", false
+	}
+	return match, strings.TrimPrefix(name, matchPrefix+n.separator), true
+}
+
+// ResourceScheme is the URI scheme of resources exposed by the gateway
+const ResourceScheme = "onemcp"
+
+// ResourceURI returns the exposed URI (or URI template) of a server's resource.
+// The original URI is kept verbatim after the server segment, so the mapping is reversible.
+func ResourceURI(server, uri string) string {
+	return ResourceScheme + "://" + server + "/" + uri
+}
+
+// ParseResourceURI splits an exposed resource URI into the server name and original URI
+func ParseResourceURI(uri string) (string, string, bool) {
+	rest, ok := strings.CutPrefix(uri, ResourceScheme+"://")
+	if !ok {
+		return "", "", false
+	}
+
+	server, original, ok := strings.Cut(rest, "/")
+	if !ok || server == "" || original == "" {
+		return "", "", false
+	}
+	return server, original, true
+}
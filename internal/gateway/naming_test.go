@@ -0,0 +1,92 @@
+package gateway
+
+import (
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+func TestToolNamerRoundTrip(t *testing.T) {
+	servers := []*storage.ServerConfig{
+		{Name: "github"},
+		{Name: "git"},
+		{Name: "fs", Config: map[string]interface{}{ToolPrefixKey: "files"}},
+		{Name: "plain", Config: map[string]interface{}{ToolPrefixKey: ""}},
+	}
+
+	tests := []struct {
+		separator string
+		server    int
+		tool      string
+		exposed   string
+	}{
+		{"", 0, "create_issue", "github__create_issue"},
+		{"", 1, "status", "git__status"},
+		// The longest prefix wins, so git does not claim github's tools
+		{"", 0, "git__status", "github__git__status"},
+		{"", 2, "read_file", "files__read_file"},
+		{".", 0, "search", "github.search"},
+		{".", 2, "read.file", "files.read.file"},
+	}
+
+	for _, tt := range tests {
+		namer := NewToolNamer(config.GatewayConfig{ToolSeparator: tt.separator})
+		server := servers[tt.server]
+
+		exposed := namer.Name(server, tt.tool)
+		if exposed != tt.exposed {
+			t.Errorf("Name(%s, %s) = %q, want %q", server.Name, tt.tool, exposed, tt.exposed)
+			continue
+		}
+
+		got, tool, ok := namer.Resolve(servers, exposed)
+		if !ok || got != server || tool != tt.tool {
+			name := "<nil>"
+			if got != nil {
+				name = got.Name
+			}
+			t.Errorf("Resolve(%q) = %s, %q, %v; want %s, %q", exposed, name, tool, ok, server.Name, tt.tool)
+		}
+	}
+}
+
+func TestToolNamerUnprefixed(t *testing.T) {
+	servers := []*storage.ServerConfig{
+		{Name: "github"},
+		{Name: "plain", Config: map[string]interface{}{ToolPrefixKey: ""}},
+	}
+
+	namer := NewToolNamer(config.GatewayConfig{})
+	if got := namer.Name(servers[1], "echo"); got != "echo" {
+		t.Errorf("Name with an empty prefix override = %q, want echo", got)
+	}
+	if _, _, ok := namer.Resolve(servers, "echo"); ok {
+		t.Error("Resolve resolved the tool of an unprefixed server")
+	}
+	if _, _, ok := namer.Resolve(servers, "unknown__echo"); ok {
+		t.Error("Resolve resolved an unknown prefix")
+	}
+
+	none := NewToolNamer(config.GatewayConfig{ToolNaming: config.ToolNamingNone})
+	if got := none.Name(servers[0], "echo"); got != "echo" {
+		t.Errorf("Name with tool naming none = %q, want echo", got)
+	}
+	if _, _, ok := none.Resolve(servers, "github__echo"); ok {
+		t.Error("Resolve resolved a name with tool naming none")
+	}
+}
+
+func TestParseResourceURI(t *testing.T) {
+	uri := ResourceURI("fs", "file:///tmp/a b.txt")
+	server, original, ok := ParseResourceURI(uri)
+	if !ok || server != "fs" || original != "file:///tmp/a b.txt" {
+		t.Errorf("ParseResourceURI(%q) = %q, %q, %v", uri, server, original, ok)
+	}
+
+	for _, uri := range []string{"file:///tmp/a", "onemcp://fs", "onemcp:///file", "onemcp://fs/"} {
+		if _, _, ok := ParseResourceURI(uri); ok {
+			t.Errorf("ParseResourceURI(%q) accepted an invalid URI", uri)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// prSetChildSubreaper makes orphaned descendants children of the calling process
+const prSetChildSubreaper = 36
+
+func TestStopEndsDetachedGrandchildren(t *testing.T) {
+	// Orphans become children of the test, so that it can see them exit
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 1, 0); errno != 0 {
+		t.Skipf("cannot become a child subreaper: %v", errno)
+	}
+	defer syscall.RawSyscall(syscall.SYS_PRCTL, prSetChildSubreaper, 0, 0)
+
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pidFile := filepath.Join(t.TempDir(), "grandchild.pid")
+	// The grandchild lets go of the pipes, and the server exits as soon as its stdin closes
+	script := fmt.Sprintf("sleep 300 </dev/null >/dev/null 2>&1 & echo $! > %s; exec cat >/dev/null", pidFile)
+	if err := store.SaveServerConfig(&storage.ServerConfig{
+		Name:            "spawner",
+		Command:         "sh",
+		Args:            []string{"-c", script},
+		RestartPolicy:   storage.RestartNever,
+		StopGracePeriod: "1s",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	if _, _, err := gw.startProcess("spawner"); err != nil {
+		t.Fatal(err)
+	}
+
+	var pid int
+	for deadline := time.Now().Add(5 * time.Second); pid == 0; {
+		if data, err := os.ReadFile(pidFile); err == nil && strings.HasSuffix(string(data), "\n") {
+			pid, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		} else if time.Now().After(deadline) {
+			t.Fatal("the server did not start its grandchild")
+		} else {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// The grandchild is the test's to reap once the server has exited
+	reaped := make(chan syscall.WaitStatus, 1)
+	go func() {
+		for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); {
+			var status syscall.WaitStatus
+			if got, _ := syscall.Wait4(pid, &status, syscall.WNOHANG, nil); got == pid {
+				reaped <- status
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	start := time.Now()
+	if err := gw.StopServer("spawner"); err != nil {
+		t.Fatalf("StopServer: %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("StopServer took %s; the grandchild should go with SIGTERM", elapsed)
+	}
+
+	select {
+	case status := <-reaped:
+		if !status.Signaled() || status.Signal() != syscall.SIGTERM {
+			t.Errorf("grandchild exited with %v, want SIGTERM", status)
+		}
+	case <-time.After(5 * time.Second):
+		syscall.Kill(pid, syscall.SIGKILL)
+		t.Fatal("the grandchild outlived its stopped server")
+	}
+}
@@ -0,0 +1,41 @@
+//go:build !windows
+
+package gateway
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so that stopping
+// it also reaches the processes it spawns
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// terminateGroup asks every process in the server's process group to exit
+func terminateGroup(process *os.Process) error {
+	return signalGroup(process, syscall.SIGTERM)
+}
+
+// killGroup forcibly ends every process in the server's process group
+func killGroup(process *os.Process) error {
+	return signalGroup(process, syscall.SIGKILL)
+}
+
+// groupAlive reports whether any process is left in the process group led by
+// process, which outlives its leader for as long as any member runs
+func groupAlive(process *os.Process) bool {
+	return syscall.Kill(-process.Pid, 0) == nil
+}
+
+// signalGroup signals the process group led by process. A group that is already
+// gone is not an error.
+func signalGroup(process *os.Process, sig syscall.Signal) error {
+	if err := syscall.Kill(-process.Pid, sig); err != nil && !errors.Is(err, syscall.ESRCH) {
+		return err
+	}
+	return nil
+}
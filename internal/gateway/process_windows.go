@@ -0,0 +1,37 @@
+//go:build windows
+
+package gateway
+
+import (
+	"os"
+	"os/exec"
+	"strconv"
+	"syscall"
+)
+
+// setProcessGroup starts the command in its own process group, so that stopping
+// it also reaches the processes it spawns
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{CreationFlags: syscall.CREATE_NEW_PROCESS_GROUP}
+}
+
+// terminateGroup ends the server's process tree. Windows has no polite
+// equivalent of SIGTERM for console processes, so this is the same as killGroup.
+func terminateGroup(process *os.Process) error {
+	return killGroup(process)
+}
+
+// killGroup forcibly ends the server's process tree
+func killGroup(process *os.Process) error {
+	if err := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(process.Pid)).Run(); err != nil {
+		// The tree may already be gone; make sure the server itself is
+		return process.Kill()
+	}
+	return nil
+}
+
+// groupAlive reports false, as Windows keeps no group to look up once the server
+// has exited; killGroup reaches its processes while it runs
+func groupAlive(process *os.Process) bool {
+	return false
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ProgressFunc delivers a progress notification to the client that made a request
+type ProgressFunc func(params *mcpsdk.ProgressNotificationParams)
+
+// progressRequest is a client's request for progress, under the client's own token
+type progressRequest struct {
+	token  interface{}
+	report ProgressFunc
+}
+
+type progressRequestKey struct{}
+
+type progressTokenKey struct{}
+
+// WithProgress returns a context under which proxied requests report the progress
+// of the server that handles them to fn, under the client's progress token
+func WithProgress(ctx context.Context, token interface{}, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressRequestKey{}, &progressRequest{token: token, report: fn})
+}
+
+// progressRoute leads progress notifications of one server request back to its client
+type progressRoute struct {
+	server string
+	client *progressRequest
+}
+
+// progressRoutes maps the progress tokens the gateway hands to servers onto the
+// clients waiting for that progress. Tokens are unique across servers.
+type progressRoutes struct {
+	next   atomic.Int64
+	routes map[string]*progressRoute
+	mu     sync.Mutex
+}
+
+// trackProgress gives a request to process its own progress token, if the client
+// asked for progress. The returned function ends the tracking; progress reported
+// after that is dropped.
+func (g *Gateway) trackProgress(ctx context.Context, process *ServerProcess) (context.Context, func()) {
+	client, ok := ctx.Value(progressRequestKey{}).(*progressRequest)
+	if !ok || client.report == nil {
+		return ctx, func() {}
+	}
+
+	token := fmt.Sprintf("onemcp-%d", g.progress.next.Add(1))
+
+	g.progress.mu.Lock()
+	if g.progress.routes == nil {
+		g.progress.routes = make(map[string]*progressRoute)
+	}
+	g.progress.routes[token] = &progressRoute{server: process.Name, client: client}
+	g.progress.mu.Unlock()
+
+	release := func() {
+		g.progress.mu.Lock()
+		delete(g.progress.routes, token)
+		g.progress.mu.Unlock()
+	}
+	return context.WithValue(ctx, progressTokenKey{}, token), release
+}
+
+// routeProgress passes a server's progress notification on to the client that made
+// the request, under the token the client chose
+func (g *Gateway) routeProgress(process *ServerProcess, params *mcpsdk.ProgressNotificationParams) {
+	token, ok := params.ProgressToken.(string)
+	if !ok {
+		return
+	}
+
+	g.progress.mu.Lock()
+	route, ok := g.progress.routes[token]
+	g.progress.mu.Unlock()
+
+	// The request has finished or was cancelled, or the token is not this server's
+	if !ok || route.server != process.Name {
+		return
+	}
+	forwarded := *params
+	forwarded.ProgressToken = route.client.token
+	route.client.report(&forwarded)
+}
+
+// withProgressToken adds the request's progress token, if any, to its encoded params
+func withProgressToken(ctx context.Context, raw json.RawMessage) (json.RawMessage, error) {
+	token, ok := ctx.Value(progressTokenKey{}).(string)
+	if !ok {
+		return raw, nil
+	}
+
+	params := make(map[string]json.RawMessage)
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &params); err != nil {
+			return nil, err
+		}
+	}
+
+	meta := make(map[string]interface{})
+	if existing, ok := params["_meta"]; ok {
+		if err := json.Unmarshal(existing, &meta); err != nil {
+			return nil, err
+		}
+	}
+	meta["progressToken"] = token
+
+	encoded, err := json.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+	params["_meta"] = encoded
+	return json.Marshal(params)
+}
@@ -0,0 +1,168 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// progressToken returns the progress token the gateway gave the server in req
+func progressToken(t *testing.T, req *jsonrpc.Request) string {
+	t.Helper()
+	var params struct {
+		Meta struct {
+			ProgressToken string `json:"progressToken"`
+		} `json:"_meta"`
+	}
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(params.Meta.ProgressToken, "onemcp-") {
+		t.Fatalf("server got progress token %q; want one of the gateway's", params.Meta.ProgressToken)
+	}
+	return params.Meta.ProgressToken
+}
+
+// sendProgress has the child report progress under token
+func (c *fakeChild) sendProgress(token, message string) {
+	c.t.Helper()
+	params, err := json.Marshal(&mcpsdk.ProgressNotificationParams{ProgressToken: token, Progress: 1, Total: 2, Message: message})
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	c.write(&jsonrpc.Request{Method: "notifications/progress", Params: params})
+}
+
+// answer has the child answer a tool call
+func (c *fakeChild) answer(req *jsonrpc.Request) {
+	c.t.Helper()
+	c.write(&jsonrpc.Response{ID: req.ID, Result: json.RawMessage(`{"content":[]}`)})
+}
+
+// reportTo returns a ProgressFunc that passes progress on to a channel
+func reportTo(progress chan *mcpsdk.ProgressNotificationParams) ProgressFunc {
+	return func(params *mcpsdk.ProgressNotificationParams) {
+		progress <- params
+	}
+}
+
+// callTool calls a tool in the background and returns a channel with its error
+func callTool(ctx context.Context, g *Gateway, name, args string) <-chan error {
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.CallTool(ctx, name, json.RawMessage(args))
+		errc <- err
+	}()
+	return errc
+}
+
+func TestProgressReachesClientUnderItsToken(t *testing.T) {
+	g, _, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	progress := make(chan *mcpsdk.ProgressNotificationParams, 4)
+	ctx := WithProgress(context.Background(), "client-7", reportTo(progress))
+
+	errc := callTool(ctx, g, "github__search", `{}`)
+	req := child.readRequest("tools/call")
+	token := progressToken(t, req)
+
+	// Another server cannot report progress on this request
+	g.routeProgress(newTestProcess("other"), &mcpsdk.ProgressNotificationParams{ProgressToken: token, Progress: 1})
+
+	child.sendProgress(token, "halfway")
+	child.answer(req)
+	if err := <-errc; err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+
+	// Notifications are handled in order, so the progress arrived before the answer
+	select {
+	case got := <-progress:
+		if got.ProgressToken != "client-7" || got.Progress != 1 || got.Total != 2 || got.Message != "halfway" {
+			t.Errorf("client got progress %+v; want the server's under token client-7", got)
+		}
+	default:
+		t.Fatal("client got no progress")
+	}
+
+	// Progress on a finished request is dropped; the next answer shows it was handled
+	child.sendProgress(token, "late")
+	errc = callTool(context.Background(), g, "github__search", `{}`)
+	child.answer(child.readRequest("tools/call"))
+	if err := <-errc; err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+	select {
+	case got := <-progress:
+		t.Errorf("client got progress %+v after the answer", got)
+	default:
+	}
+}
+
+func TestProgressOfConcurrentRequestsWithSameToken(t *testing.T) {
+	g, _, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+	first := make(chan *mcpsdk.ProgressNotificationParams, 4)
+	second := make(chan *mcpsdk.ProgressNotificationParams, 4)
+
+	// Two clients may pick the same token for requests that run at once
+	firstErr := callTool(WithProgress(context.Background(), "shared", reportTo(first)), g, "github__search", `{"client":"first"}`)
+	secondErr := callTool(WithProgress(context.Background(), "shared", reportTo(second)), g, "github__search", `{"client":"second"}`)
+
+	requests := make(map[string]*jsonrpc.Request)
+	tokens := make(map[string]string)
+	for i := 0; i < 2; i++ {
+		req := child.readRequest("tools/call")
+		var params struct {
+			Arguments struct {
+				Client string `json:"client"`
+			} `json:"arguments"`
+		}
+		if err := json.Unmarshal(req.Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		requests[params.Arguments.Client] = req
+		tokens[params.Arguments.Client] = progressToken(t, req)
+	}
+	if tokens["first"] == tokens["second"] {
+		t.Fatalf("both requests got progress token %q; want one each", tokens["first"])
+	}
+
+	child.sendProgress(tokens["second"], "second")
+	child.sendProgress(tokens["first"], "first")
+	child.answer(requests["first"])
+	child.answer(requests["second"])
+	for _, errc := range []<-chan error{firstErr, secondErr} {
+		if err := <-errc; err != nil {
+			t.Fatalf("CallTool: %v", err)
+		}
+	}
+
+	for name, progress := range map[string]chan *mcpsdk.ProgressNotificationParams{"first": first, "second": second} {
+		if len(progress) != 1 {
+			t.Fatalf("%s client got %d progress notifications; want 1", name, len(progress))
+		}
+		got := <-progress
+		if got.Message != name || got.ProgressToken != "shared" {
+			t.Errorf("%s client got progress %+v; want its own under token shared", name, got)
+		}
+	}
+}
+
+func TestNoProgressTokenWithoutClientToken(t *testing.T) {
+	g, _, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+
+	errc := callTool(context.Background(), g, "github__search", `{}`)
+	req := child.readRequest("tools/call")
+	if strings.Contains(string(req.Params), "progressToken") {
+		t.Errorf("server got params %s; want no progress token", req.Params)
+	}
+	child.answer(req)
+	if err := <-errc; err != nil {
+		t.Fatalf("CallTool: %v", err)
+	}
+}
@@ -0,0 +1,359 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// connectRemote opens a client connection to a remote server over its configured transport
+func (g *Gateway) connectRemote(ctx context.Context, process *ServerProcess) (mcpsdk.Connection, error) {
+	if process.Config.URL == "" {
+		return nil, fmt.Errorf("remote server %s has no URL", process.Name)
+	}
+
+	headers, err := g.remoteHeaders(process)
+	if err != nil {
+		return nil, err
+	}
+
+	transport := &headerTransport{base: http.DefaultTransport, headers: headers}
+	client := &http.Client{Transport: transport}
+
+	switch process.Config.Transport {
+	case "", storage.RemoteTransportStreamable:
+		conn, err := (&mcpsdk.StreamableClientTransport{Endpoint: process.Config.URL, HTTPClient: client}).Connect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", process.Config.URL, err)
+		}
+		return newStreamableConn(process.Name, process.Config.URL, client, transport, conn), nil
+	case storage.RemoteTransportSSE:
+		conn, err := (&mcpsdk.SSEClientTransport{Endpoint: process.Config.URL, HTTPClient: client}).Connect(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to %s: %w", process.Config.URL, err)
+		}
+		return conn, nil
+	default:
+		return nil, fmt.Errorf("unsupported remote transport: %s", process.Config.Transport)
+	}
+}
+
+// remoteHeaders builds the HTTP headers sent to a remote server, filling
+// credential-backed headers from the server's stored credentials
+func (g *Gateway) remoteHeaders(process *ServerProcess) (http.Header, error) {
+	headers := make(http.Header)
+	for name, value := range process.Config.Headers {
+		headers.Set(name, value)
+	}
+
+	if len(process.Config.CredentialHeaders) == 0 && process.Config.BearerCredential == "" {
+		return headers, nil
+	}
+
+	creds, err := g.storage.LoadCredentials(process.Name)
+	if err != nil {
+		return nil, err
+	}
+	credential := func(key string) (string, error) {
+		value, ok := creds.Data[key]
+		if !ok {
+			return "", fmt.Errorf("credential %s for server %s is not set", key, process.Name)
+		}
+		return value, nil
+	}
+
+	for name, key := range process.Config.CredentialHeaders {
+		value, err := credential(key)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set(name, value)
+	}
+
+	if key := process.Config.BearerCredential; key != "" {
+		value, err := credential(key)
+		if err != nil {
+			return nil, err
+		}
+		headers.Set("Authorization", "Bearer "+value)
+	}
+
+	return headers, nil
+}
+
+// headerTransport adds the configured headers, and the negotiated protocol
+// version once known, to every request sent to a remote server
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+
+	protocolVersion string
+	mu              sync.Mutex
+}
+
+// RoundTrip sends the request with the extra headers applied
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+
+	t.mu.Lock()
+	if t.protocolVersion != "" && req.Header.Get("Mcp-Protocol-Version") == "" {
+		req.Header.Set("Mcp-Protocol-Version", t.protocolVersion)
+	}
+	t.mu.Unlock()
+
+	return t.base.RoundTrip(req)
+}
+
+// Reconnection of the standalone event stream of a remote server
+const (
+	streamRetryBase = time.Second
+	streamRetryMax  = 30 * time.Second
+
+	// maxStreamRetries is how often in a row the stream may fail to open before
+	// the connection is given up and left to the restart policy
+	maxStreamRetries = 5
+)
+
+// streamableConn wraps the SDK's Streamable HTTP client connection. The SDK only
+// opens the standalone event stream, which carries notifications not tied to a
+// request, from its own client; the gateway drives the protocol itself, so the
+// stream is opened here once the session is initialized, and reopened from the
+// last event seen when it drops.
+type streamableConn struct {
+	mcpsdk.Connection
+
+	name      string
+	endpoint  string
+	client    *http.Client
+	transport *headerTransport
+
+	incoming chan jsonrpc.Message
+	failed   chan struct{}
+	failOnce sync.Once
+	err      error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// newStreamableConn wraps conn and starts reading from it
+func newStreamableConn(name, endpoint string, client *http.Client, transport *headerTransport, conn mcpsdk.Connection) *streamableConn {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &streamableConn{
+		Connection: conn,
+		name:       name,
+		endpoint:   endpoint,
+		client:     client,
+		transport:  transport,
+		incoming:   make(chan jsonrpc.Message),
+		failed:     make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+
+	go c.pump()
+	return c
+}
+
+// pump forwards messages read from the wrapped connection
+func (c *streamableConn) pump() {
+	for {
+		msg, err := c.Connection.Read(c.ctx)
+		if err != nil {
+			c.fail(err)
+			return
+		}
+		if !c.deliver(msg) {
+			return
+		}
+	}
+}
+
+// fail makes Read return err, ending the session
+func (c *streamableConn) fail(err error) {
+	c.failOnce.Do(func() {
+		c.err = err
+		close(c.failed)
+	})
+}
+
+// deliver queues a message for Read. It reports false once the connection is closed.
+func (c *streamableConn) deliver(msg jsonrpc.Message) bool {
+	select {
+	case c.incoming <- msg:
+		return true
+	case <-c.ctx.Done():
+		return false
+	}
+}
+
+// Read returns the next message from either the request streams or the standalone stream
+func (c *streamableConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	select {
+	case msg := <-c.incoming:
+		return msg, nil
+	case <-c.failed:
+		return nil, c.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Close stops the standalone stream and closes the wrapped connection
+func (c *streamableConn) Close() error {
+	c.cancel()
+	return c.Connection.Close()
+}
+
+// initialized records the negotiated protocol version and opens the standalone stream
+func (c *streamableConn) initialized(result *mcpsdk.InitializeResult) {
+	c.transport.mu.Lock()
+	c.transport.protocolVersion = result.ProtocolVersion
+	c.transport.mu.Unlock()
+
+	go c.listen()
+}
+
+// listen reads server-initiated messages from the standalone event stream for as
+// long as the connection is open. A dropped stream is reopened with exponential
+// backoff, resuming after the last event received, so that servers keeping
+// events can replay the ones sent in between.
+func (c *streamableConn) listen() {
+	var lastEventID string
+	retry := streamRetryBase
+	connected := false
+	for failures := 0; ; {
+		opened, err := c.stream(&lastEventID, &retry)
+		if c.ctx.Err() != nil {
+			return
+		}
+		connected = connected || opened
+
+		var refused *streamRefusedError
+		if errors.As(err, &refused) {
+			switch {
+			case refused.code == http.StatusMethodNotAllowed, refused.code == http.StatusNotFound && !connected:
+				// The server does not offer a standalone stream; some answer 404 for that
+				return
+			case refused.code == http.StatusNotFound:
+				// The server forgot the session, so the connection is over
+				c.fail(fmt.Errorf("event stream of server %s: %w", c.name, err))
+				return
+			}
+		}
+
+		if opened {
+			failures = 0
+		} else if failures++; failures > maxStreamRetries {
+			log.Printf("Giving up on the event stream of server %s: %v", c.name, err)
+			c.fail(fmt.Errorf("event stream of server %s: %w", c.name, err))
+			return
+		}
+
+		delay := min(retry<<max(failures-1, 0), streamRetryMax)
+		if err != nil {
+			log.Printf("Event stream of server %s failed: %v; reconnecting in %s", c.name, err, delay)
+		} else {
+			log.Printf("Event stream of server %s ended; reconnecting in %s", c.name, delay)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-c.ctx.Done():
+			timer.Stop()
+			return
+		}
+	}
+}
+
+// streamRefusedError reports a standalone stream request the server refused
+type streamRefusedError struct {
+	status string
+	code   int
+}
+
+func (e *streamRefusedError) Error() string {
+	return "server answered " + e.status
+}
+
+// stream opens the standalone event stream, resuming after *lastEventID if set,
+// and delivers its messages until it ends. It keeps *lastEventID and the retry
+// delay the server asks for up to date, and reports whether the stream opened.
+func (c *streamableConn) stream(lastEventID *string, retry *time.Duration) (bool, error) {
+	req, err := http.NewRequestWithContext(c.ctx, http.MethodGet, c.endpoint, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if sessionID := c.SessionID(); sessionID != "" {
+		req.Header.Set("Mcp-Session-Id", sessionID)
+	}
+	if *lastEventID != "" {
+		req.Header.Set("Last-Event-ID", *lastEventID)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, &streamRefusedError{status: resp.Status, code: resp.StatusCode}
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+
+	var data bytes.Buffer
+	var id string
+	for scanner.Scan() {
+		line := scanner.Bytes()
+		if len(line) == 0 {
+			if data.Len() > 0 {
+				if msg, err := jsonrpc.DecodeMessage(data.Bytes()); err != nil {
+					log.Printf("Ignoring invalid event from server %s: %v", c.name, err)
+				} else if !c.deliver(msg) {
+					return true, nil
+				}
+				data.Reset()
+			}
+			if id != "" {
+				*lastEventID = id
+			}
+			continue
+		}
+
+		field, value, _ := bytes.Cut(line, []byte(":"))
+		value = bytes.TrimPrefix(value, []byte(" "))
+		switch string(field) {
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.Write(value)
+		case "id":
+			id = string(value)
+		case "retry":
+			if ms, err := strconv.Atoi(string(value)); err == nil && ms > 0 {
+				*retry = time.Duration(ms) * time.Millisecond
+			}
+		}
+	}
+	return true, scanner.Err()
+}
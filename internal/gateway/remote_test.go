@@ -0,0 +1,252 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newStubServer builds a remote MCP server with one tool, one resource and one prompt
+func newStubServer() *mcpsdk.Server {
+	server := mcpsdk.NewServer(&mcpsdk.Implementation{Name: "stub", Version: "1.0.0"}, nil)
+
+	type echoArgs struct {
+		Text string `json:"text"`
+	}
+	mcpsdk.AddTool(server, &mcpsdk.Tool{Name: "echo", Description: "Echoes its text"},
+		func(ctx context.Context, req *mcpsdk.CallToolRequest, args echoArgs) (*mcpsdk.CallToolResult, any, error) {
+			return &mcpsdk.CallToolResult{Content: []mcpsdk.Content{&mcpsdk.TextContent{Text: args.Text}}}, nil, nil
+		})
+	server.AddResource(&mcpsdk.Resource{URI: "stub://readme", Name: "readme"},
+		func(ctx context.Context, req *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+			return &mcpsdk.ReadResourceResult{Contents: []*mcpsdk.ResourceContents{{URI: req.Params.URI, Text: "hello"}}}, nil
+		})
+	server.AddPrompt(&mcpsdk.Prompt{Name: "greet"},
+		func(ctx context.Context, req *mcpsdk.GetPromptRequest) (*mcpsdk.GetPromptResult, error) {
+			return &mcpsdk.GetPromptResult{Messages: []*mcpsdk.PromptMessage{{Role: "user", Content: &mcpsdk.TextContent{Text: "hi"}}}}, nil
+		})
+	return server
+}
+
+// headerRecorder records the headers of every request before passing it on
+type headerRecorder struct {
+	next http.Handler
+
+	headers []http.Header
+	mu      sync.Mutex
+}
+
+func (h *headerRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	h.headers = append(h.headers, r.Header.Clone())
+	h.mu.Unlock()
+	h.next.ServeHTTP(w, r)
+}
+
+func TestRemoteServer(t *testing.T) {
+	for _, transport := range []string{storage.RemoteTransportStreamable, storage.RemoteTransportSSE} {
+		t.Run(transport, func(t *testing.T) {
+			t.Setenv(storage.EnvMasterKey, "")
+			t.Setenv(storage.EnvKeyFile, "")
+			t.Setenv(storage.EnvPassphrase, "")
+
+			stub := newStubServer()
+			getServer := func(*http.Request) *mcpsdk.Server { return stub }
+			var handler http.Handler = mcpsdk.NewStreamableHTTPHandler(getServer, nil)
+			if transport == storage.RemoteTransportSSE {
+				handler = mcpsdk.NewSSEHandler(getServer, nil)
+			}
+			recorder := &headerRecorder{next: handler}
+			httpServer := httptest.NewServer(recorder)
+			defer httpServer.Close()
+
+			store, err := storage.NewFileStorage(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveServerConfig(&storage.ServerConfig{
+				Name:              "remote",
+				Type:              storage.ServerTypeRemote,
+				URL:               httpServer.URL,
+				Transport:         transport,
+				Headers:           map[string]string{"X-Client": "onemcp"},
+				CredentialHeaders: map[string]string{"X-Api-Key": "api_key"},
+				BearerCredential:  "token",
+			}); err != nil {
+				t.Fatal(err)
+			}
+			if err := store.SaveCredentials("remote", &storage.Credential{Data: map[string]string{
+				"api_key": "KEY",
+				"token":   "TOKEN",
+			}}); err != nil {
+				t.Fatal(err)
+			}
+
+			gw := NewGateway(config.DefaultConfig(), store)
+			if err := gw.StartServer("remote"); err != nil {
+				t.Fatalf("StartServer: %v", err)
+			}
+			defer gw.StopServer("remote")
+
+			tools := gw.ListTools()
+			if len(tools) != 1 || tools[0].Name != "remote__echo" || tools[0].Server != "remote" {
+				t.Errorf("tools = %+v, want remote__echo", tools)
+			}
+			resources := gw.ListResources()
+			if len(resources) != 1 || resources[0].URI != ResourceURI("remote", "stub://readme") {
+				t.Errorf("resources = %+v, want stub://readme of remote", resources)
+			}
+			prompts := gw.ListPrompts()
+			if len(prompts) != 1 || prompts[0].Name != "remote__greet" {
+				t.Errorf("prompts = %+v, want remote__greet", prompts)
+			}
+
+			args, _ := json.Marshal(map[string]string{"text": "ping"})
+			result, err := gw.CallTool(context.Background(), "remote__echo", args)
+			if err != nil {
+				t.Fatalf("CallTool: %v", err)
+			}
+			if text, ok := result.Content[0].(*mcpsdk.TextContent); !ok || text.Text != "ping" {
+				t.Errorf("CallTool returned %+v, want ping", result.Content)
+			}
+
+			recorder.mu.Lock()
+			defer recorder.mu.Unlock()
+			if len(recorder.headers) == 0 {
+				t.Fatal("the server received no requests")
+			}
+			for i, header := range recorder.headers {
+				if got := header.Get("Authorization"); got != "Bearer TOKEN" {
+					t.Errorf("request %d: Authorization = %q, want Bearer TOKEN", i, got)
+				}
+				if got := header.Get("X-Api-Key"); got != "KEY" {
+					t.Errorf("request %d: X-Api-Key = %q, want KEY", i, got)
+				}
+				if got := header.Get("X-Client"); got != "onemcp" {
+					t.Errorf("request %d: X-Client = %q, want onemcp", i, got)
+				}
+			}
+		})
+	}
+}
+
+// droppableStreams lets a test cut the standalone event streams it serves
+type droppableStreams struct {
+	next http.Handler
+
+	cancels      []context.CancelFunc
+	lastEventIDs []string // Last-Event-ID of each stream request
+	mu           sync.Mutex
+}
+
+func (d *droppableStreams) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		ctx, cancel := context.WithCancel(r.Context())
+		d.mu.Lock()
+		d.cancels = append(d.cancels, cancel)
+		d.lastEventIDs = append(d.lastEventIDs, r.Header.Get("Last-Event-ID"))
+		d.mu.Unlock()
+		r = r.WithContext(ctx)
+	}
+	d.next.ServeHTTP(w, r)
+}
+
+// drop ends every stream opened so far
+func (d *droppableStreams) drop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, cancel := range d.cancels {
+		cancel()
+	}
+}
+
+// streams returns the Last-Event-ID of every stream request so far
+func (d *droppableStreams) streams() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string(nil), d.lastEventIDs...)
+}
+
+// waitFor polls until cond holds
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(10 * time.Second); !cond(); {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestRemoteEventStreamResumes(t *testing.T) {
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	stub := newStubServer()
+	handler := &droppableStreams{next: mcpsdk.NewStreamableHTTPHandler(
+		func(*http.Request) *mcpsdk.Server { return stub },
+		&mcpsdk.StreamableHTTPOptions{EventStore: mcpsdk.NewMemoryEventStore(nil)},
+	)}
+	httpServer := httptest.NewServer(handler)
+	defer httpServer.Close()
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveServerConfig(&storage.ServerConfig{
+		Name: "remote",
+		Type: storage.ServerTypeRemote,
+		URL:  httpServer.URL,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	if err := gw.StartServer("remote"); err != nil {
+		t.Fatalf("StartServer: %v", err)
+	}
+	defer gw.StopServer("remote")
+
+	listed := func(name string) func() bool {
+		return func() bool {
+			for _, tool := range gw.ListTools() {
+				if tool.Name == name {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	addTool := func(name string) {
+		mcpsdk.AddTool(stub, &mcpsdk.Tool{Name: name},
+			func(ctx context.Context, req *mcpsdk.CallToolRequest, args struct{}) (*mcpsdk.CallToolResult, any, error) {
+				return &mcpsdk.CallToolResult{}, nil, nil
+			})
+	}
+
+	waitFor(t, "the event stream", func() bool { return len(handler.streams()) == 1 })
+	addTool("first")
+	waitFor(t, "list_changed over the event stream", listed("remote__first"))
+
+	// A change made while the stream is down is replayed once it is back
+	handler.drop()
+	addTool("second")
+	waitFor(t, "the event stream to reopen", func() bool { return len(handler.streams()) == 2 })
+	if resumed := handler.streams()[1]; resumed == "" {
+		t.Error("the event stream reopened without Last-Event-ID")
+	}
+	waitFor(t, "list_changed sent while the stream was down", listed("remote__second"))
+	if !gw.IsServerRunning("remote") {
+		t.Error("the connection was given up when its event stream dropped")
+	}
+}
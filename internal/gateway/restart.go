@@ -0,0 +1,268 @@
+package gateway
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// Restart defaults, used when a server's configuration does not set them
+const (
+	defaultMaxRestarts   = 5
+	defaultRestartWindow = 10 * time.Minute
+
+	restartBackoffBase = time.Second
+	restartBackoffMax  = 5 * time.Minute
+
+	// stderrTailLines is how much recent stderr is kept to explain a crash loop
+	stderrTailLines = 20
+)
+
+// clock tells the time and runs functions later. Restarts are scheduled through
+// it so that tests can control time.
+type clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func())
+}
+
+// systemClock is the clock of a running gateway
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) AfterFunc(d time.Duration, f func()) { time.AfterFunc(d, f) }
+
+// restartState tracks the exits and automatic restarts of a server
+type restartState struct {
+	restarts   []time.Time // automatic restarts within the restart window
+	pending    bool        // a restart is scheduled
+	crashed    bool        // too many restarts; left down until reset
+	exited     bool
+	exitCode   int
+	stderrTail []string
+	mu         sync.Mutex
+}
+
+// recordStderr keeps the last lines a server wrote to stderr
+func (p *ServerProcess) recordStderr(line string) {
+	p.restart.mu.Lock()
+	defer p.restart.mu.Unlock()
+
+	p.restart.stderrTail = append(p.restart.stderrTail, line)
+	if len(p.restart.stderrTail) > stderrTailLines {
+		p.restart.stderrTail = p.restart.stderrTail[len(p.restart.stderrTail)-stderrTailLines:]
+	}
+}
+
+// serverExited records how a server went down and restarts it if its policy says so
+func (g *Gateway) serverExited(process *ServerProcess, exitCode int, failed bool) {
+	process.restart.mu.Lock()
+	process.restart.exited = true
+	process.restart.exitCode = exitCode
+	process.restart.mu.Unlock()
+
+	g.scheduleRestart(process, failed)
+}
+
+// scheduleRestart restarts a server that went down after an exponential, jittered
+// backoff. A server restarted too often within its window is marked as errored
+// and left down until it is reset.
+func (g *Gateway) scheduleRestart(process *ServerProcess, failed bool) {
+	if g.stopping() || process.StoppedOnRequest() {
+		return
+	}
+
+	switch process.Config.RestartPolicy {
+	case storage.RestartNever:
+		return
+	case storage.RestartOnFailure:
+		if !failed {
+			return
+		}
+	}
+
+	maxRestarts, window := restartLimits(process.Config)
+
+	state := &process.restart
+	state.mu.Lock()
+	if state.pending || state.crashed {
+		state.mu.Unlock()
+		return
+	}
+
+	now := g.clock.Now()
+	recent := state.restarts[:0]
+	for _, t := range state.restarts {
+		if now.Sub(t) < window {
+			recent = append(recent, t)
+		}
+	}
+	state.restarts = recent
+
+	if len(state.restarts) >= maxRestarts {
+		state.crashed = true
+		exitCode := state.exitCode
+		state.mu.Unlock()
+
+		log.Printf("Server %s restarted %d times within %s (last exit code %d); giving up until it is reset",
+			process.Name, maxRestarts, window, exitCode)
+		g.setStatus(process, storage.StatusError)
+		g.dropCatalog(process)
+		return
+	}
+
+	delay := restartDelay(len(state.restarts), rand.Float64())
+	state.restarts = append(state.restarts, now)
+	state.pending = true
+	state.mu.Unlock()
+
+	log.Printf("Restarting server %s in %s", process.Name, delay.Round(time.Millisecond))
+	g.clock.AfterFunc(delay, func() { g.restartServer(process) })
+}
+
+// markErrored gives up on a server whose configuration keeps it from starting. It
+// is not restarted until it is reset.
+func (g *Gateway) markErrored(process *ServerProcess, err error) {
+	process.restart.mu.Lock()
+	process.restart.crashed = true
+	process.restart.mu.Unlock()
+
+	log.Printf("Server %s cannot start until its configuration is fixed and it is reset: %v", process.Name, err)
+	g.setStatus(process, storage.StatusError)
+}
+
+// restartServer performs a scheduled restart
+func (g *Gateway) restartServer(process *ServerProcess) {
+	process.restart.mu.Lock()
+	process.restart.pending = false
+	process.restart.mu.Unlock()
+
+	if g.stopping() || process.StoppedOnRequest() || process.IsRunning() {
+		return
+	}
+
+	if err := g.StartServer(process.Name); err != nil {
+		log.Printf("Failed to restart server %s: %v", process.Name, err)
+		// A server that started but failed its handshake is rescheduled when it exits
+		if !process.IsRunning() {
+			g.scheduleRestart(process, true)
+		}
+		return
+	}
+	log.Printf("Successfully restarted server: %s", process.Name)
+}
+
+// restartDelay returns the backoff before the given restart attempt, with ±20%
+// jitter chosen by random, a number in [0, 1)
+func restartDelay(attempt int, random float64) time.Duration {
+	delay := restartBackoffBase
+	for i := 0; i < attempt && delay < restartBackoffMax; i++ {
+		delay *= 2
+	}
+	if delay > restartBackoffMax {
+		delay = restartBackoffMax
+	}
+	return time.Duration(float64(delay) * (0.8 + 0.4*random))
+}
+
+// restartLimits returns the restart limit and window of a server
+func restartLimits(serverConfig *storage.ServerConfig) (int, time.Duration) {
+	maxRestarts := serverConfig.MaxRestarts
+	if maxRestarts <= 0 {
+		maxRestarts = defaultMaxRestarts
+	}
+
+	window := configDuration(serverConfig, "restart_window", serverConfig.RestartWindow, defaultRestartWindow)
+	if window <= 0 {
+		window = defaultRestartWindow
+	}
+	return maxRestarts, window
+}
+
+// configDuration parses a duration setting of a server, falling back to def when
+// it is unset or invalid
+func configDuration(serverConfig *storage.ServerConfig, field, value string, def time.Duration) time.Duration {
+	if value == "" {
+		return def
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Printf("Invalid %s %q for server %s, using %s", field, value, serverConfig.Name, def)
+		return def
+	}
+	return d
+}
+
+// exitFailed reports whether the server's last exit counts as a failure.
+// A server that never ran, such as one that failed to start, counts as failed.
+func (p *ServerProcess) exitFailed() bool {
+	p.restart.mu.Lock()
+	defer p.restart.mu.Unlock()
+	return !p.restart.exited || p.restart.exitCode != 0
+}
+
+// Crashed reports whether the server was given up on after too many restarts
+func (p *ServerProcess) Crashed() bool {
+	p.restart.mu.Lock()
+	defer p.restart.mu.Unlock()
+	return p.restart.crashed
+}
+
+// ResetServer clears a server's restart history and error status, then starts it
+func (g *Gateway) ResetServer(serverName string) error {
+	g.serversMux.RLock()
+	process, exists := g.servers[serverName]
+	g.serversMux.RUnlock()
+	if !exists {
+		return fmt.Errorf("server %s not found", serverName)
+	}
+
+	process.restart.mu.Lock()
+	process.restart.restarts = nil
+	process.restart.crashed = false
+	process.restart.exited = false
+	process.restart.exitCode = 0
+	process.restart.stderrTail = nil
+	process.restart.mu.Unlock()
+
+	if process.Config.Status == storage.StatusError {
+		g.setStatus(process, storage.StatusInstalled)
+	}
+
+	log.Printf("Reset server %s", serverName)
+	if process.IsRunning() {
+		return nil
+	}
+	return g.StartServer(serverName)
+}
+
+// setStatus updates and persists the stored status of a server
+func (g *Gateway) setStatus(process *ServerProcess, status storage.ServerStatus) {
+	g.serversMux.Lock()
+	process.Config.Status = status
+	serverConfig := *process.Config
+	g.serversMux.Unlock()
+
+	if err := g.storage.SaveServerConfig(&serverConfig); err != nil {
+		log.Printf("Failed to save status of server %s: %v", process.Name, err)
+	}
+}
+
+// exitInfo describes the last exit of a server for ServerInfo
+func (p *ServerProcess) exitInfo() (exitCode *int, lastError string, restarts int) {
+	p.restart.mu.Lock()
+	defer p.restart.mu.Unlock()
+
+	if p.restart.exited {
+		code := p.restart.exitCode
+		exitCode = &code
+		lastError = strings.Join(p.restart.stderrTail, "\n")
+	}
+	return exitCode, lastError, len(p.restart.restarts)
+}
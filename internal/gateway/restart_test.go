@@ -0,0 +1,212 @@
+package gateway
+
+import (
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+// fakeClock keeps scheduled functions until the test runs them
+type fakeClock struct {
+	now       time.Time
+	scheduled []scheduledFunc
+	mu        sync.Mutex
+}
+
+type scheduledFunc struct {
+	delay time.Duration
+	f     func()
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scheduled = append(c.scheduled, scheduledFunc{delay: d, f: f})
+}
+
+// next advances the clock to the earliest scheduled function, removes and returns it
+func (c *fakeClock) next(t *testing.T) scheduledFunc {
+	t.Helper()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.scheduled) == 0 {
+		t.Fatal("nothing was scheduled")
+	}
+	first := c.scheduled[0]
+	c.scheduled = c.scheduled[1:]
+	c.now = c.now.Add(first.delay)
+	return first
+}
+
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.scheduled)
+}
+
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// newRestartingGateway loads a server that cannot be spawned, under a fake clock
+func newRestartingGateway(t *testing.T, serverConfig *storage.ServerConfig) (*Gateway, *fakeClock, *storage.FileStorage) {
+	t.Helper()
+	t.Setenv(storage.EnvMasterKey, "")
+	t.Setenv(storage.EnvKeyFile, "")
+	t.Setenv(storage.EnvPassphrase, "")
+
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig.Name = "flaky"
+	serverConfig.Command = filepath.Join(t.TempDir(), "missing")
+	if err := store.SaveServerConfig(serverConfig); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	gw.clock = clock
+	return gw, clock, store
+}
+
+func TestRestartDelay(t *testing.T) {
+	tests := []struct {
+		attempt int
+		random  float64
+		want    time.Duration
+	}{
+		{0, 0.5, time.Second},
+		{1, 0.5, 2 * time.Second},
+		{3, 0.5, 8 * time.Second},
+		{8, 0.5, 256 * time.Second},
+		{9, 0.5, restartBackoffMax},
+		{50, 0.5, restartBackoffMax},
+		// ±20% jitter
+		{0, 0, 800 * time.Millisecond},
+		{2, 0.999999, 4800 * time.Millisecond},
+		{50, 0, 4 * time.Minute},
+		{50, 0.999999, 6 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := restartDelay(tt.attempt, tt.random)
+		if diff := got - tt.want; diff < -time.Millisecond || diff > time.Millisecond {
+			t.Errorf("restartDelay(%d, %v) = %s, want %s", tt.attempt, tt.random, got, tt.want)
+		}
+	}
+}
+
+func TestRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy string
+		failed bool
+		want   bool
+	}{
+		{"", true, true},
+		{"", false, true},
+		{storage.RestartAlways, false, true},
+		{storage.RestartOnFailure, true, true},
+		{storage.RestartOnFailure, false, false},
+		{storage.RestartNever, true, false},
+	}
+
+	for _, tt := range tests {
+		gw, clock, _ := newRestartingGateway(t, &storage.ServerConfig{RestartPolicy: tt.policy})
+		gw.scheduleRestart(gw.servers["flaky"], tt.failed)
+		if got := clock.pending() == 1; got != tt.want {
+			t.Errorf("policy %q, failed %v: restart scheduled = %v, want %v", tt.policy, tt.failed, got, tt.want)
+		}
+	}
+}
+
+func TestCrashLoopMarksServerErrored(t *testing.T) {
+	gw, clock, store := newRestartingGateway(t, &storage.ServerConfig{
+		RestartPolicy: storage.RestartAlways,
+		MaxRestarts:   3,
+		RestartWindow: "1m",
+	})
+	process := gw.servers["flaky"]
+
+	gw.scheduleRestart(process, true)
+	gw.scheduleRestart(process, true)
+	if n := clock.pending(); n != 1 {
+		t.Fatalf("%d restarts scheduled, want one while a restart is pending", n)
+	}
+
+	// Each restart fails to spawn and schedules the next with a longer backoff
+	for attempt, base := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second} {
+		restart := clock.next(t)
+		if restart.delay < base*8/10 || restart.delay > base*12/10 {
+			t.Errorf("restart %d after %s, want %s ±20%%", attempt, restart.delay, base)
+		}
+		restart.f()
+	}
+
+	// The third failure within the window gives up
+	if n := clock.pending(); n != 0 {
+		t.Fatalf("%d restarts scheduled after the limit, want none", n)
+	}
+	if !process.Crashed() || process.status() != string(storage.StatusError) {
+		t.Errorf("server status %s after its restart limit, want error", process.status())
+	}
+	if stored, err := store.LoadServerConfig("flaky"); err != nil || stored.Status != storage.StatusError {
+		t.Errorf("stored status = %v, %v; want error", stored.Status, err)
+	}
+
+	// Only a reset brings it back, with a fresh restart budget
+	gw.scheduleRestart(process, true)
+	if n := clock.pending(); n != 0 {
+		t.Fatalf("an errored server was restarted")
+	}
+	if err := gw.ResetServer("flaky"); err == nil {
+		t.Fatal("ResetServer started a server without an executable")
+	}
+	if process.Crashed() {
+		t.Error("the server is still errored after a reset")
+	}
+	if stored, err := store.LoadServerConfig("flaky"); err != nil || stored.Status != storage.StatusInstalled {
+		t.Errorf("stored status = %v, %v after a reset; want installed", stored.Status, err)
+	}
+	gw.scheduleRestart(process, true)
+	if restart := clock.next(t); restart.delay > 1200*time.Millisecond {
+		t.Errorf("first restart after a reset waits %s, want about 1s", restart.delay)
+	}
+}
+
+func TestRestartWindowForgetsOldRestarts(t *testing.T) {
+	gw, clock, _ := newRestartingGateway(t, &storage.ServerConfig{
+		RestartPolicy: storage.RestartAlways,
+		MaxRestarts:   2,
+		RestartWindow: "1m",
+	})
+	process := gw.servers["flaky"]
+
+	gw.scheduleRestart(process, true)
+	clock.next(t).f()
+
+	// The second restart fails after the earlier ones left the window, so the
+	// backoff starts over instead of giving up
+	clock.advance(2 * time.Minute)
+	clock.next(t).f()
+	restart := clock.next(t)
+	if restart.delay > 1200*time.Millisecond {
+		t.Errorf("restart after the window waits %s, want about 1s", restart.delay)
+	}
+	if process.Crashed() {
+		t.Error("restarts outside the window counted towards the limit")
+	}
+}
@@ -0,0 +1,342 @@
+package gateway
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// JSON-RPC error codes used by the gateway
+const (
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeInternalError  = -32603
+)
+
+// cancelTimeout bounds sending a cancellation to a server
+const cancelTimeout = 5 * time.Second
+
+// ErrSessionClosed is returned for calls on a session whose connection has gone away
+var ErrSessionClosed = errors.New("session closed")
+
+// NotificationHandler handles a notification sent by a child server
+type NotificationHandler func(method string, params json.RawMessage)
+
+// RequestHandler answers a request sent by a child server
+type RequestHandler func(ctx context.Context, method string, params json.RawMessage) (interface{}, error)
+
+// session multiplexes JSON-RPC traffic with one child server. Outgoing requests get
+// gateway-assigned ids, so concurrent calls from different clients never collide;
+// responses are matched back through the pending table, while server-initiated
+// requests and notifications are dispatched to their handlers.
+type session struct {
+	name string
+	conn mcpsdk.Connection
+
+	nextID     atomic.Int64
+	pending    map[int64]chan *jsonrpc.Response
+	pendingMux sync.Mutex
+
+	onNotification NotificationHandler
+	onRequest      RequestHandler
+
+	done    chan struct{}
+	err     error
+	closeMu sync.Once
+}
+
+// newSession starts a session over conn. The handlers may be nil.
+func newSession(name string, conn mcpsdk.Connection, onNotification NotificationHandler, onRequest RequestHandler) *session {
+	s := &session{
+		name:           name,
+		conn:           conn,
+		pending:        make(map[int64]chan *jsonrpc.Response),
+		onNotification: onNotification,
+		onRequest:      onRequest,
+		done:           make(chan struct{}),
+	}
+
+	go s.readLoop()
+	return s
+}
+
+// readLoop reads messages until the connection fails, routing each to its destination
+func (s *session) readLoop() {
+	for {
+		msg, err := s.conn.Read(context.Background())
+		if err != nil {
+			s.shutdown(err)
+			return
+		}
+
+		switch msg := msg.(type) {
+		case *jsonrpc.Response:
+			s.deliver(msg)
+		case *jsonrpc.Request:
+			if !msg.ID.IsValid() {
+				if s.onNotification != nil {
+					s.onNotification(msg.Method, msg.Params)
+				}
+				continue
+			}
+			go s.answer(msg)
+		}
+	}
+}
+
+// deliver hands a response to the call waiting for it
+func (s *session) deliver(resp *jsonrpc.Response) {
+	id, ok := resp.ID.Raw().(int64)
+	if !ok {
+		log.Printf("Server %s sent a response with unexpected id %v", s.name, resp.ID.Raw())
+		return
+	}
+
+	s.pendingMux.Lock()
+	ch, exists := s.pending[id]
+	delete(s.pending, id)
+	s.pendingMux.Unlock()
+
+	if !exists {
+		// The caller gave up on this request
+		return
+	}
+	ch <- resp
+}
+
+// answer runs the request handler for a server-initiated request and writes the response
+func (s *session) answer(req *jsonrpc.Request) {
+	var result interface{}
+	var err error
+
+	switch {
+	case req.Method == "ping":
+		result = struct{}{}
+	case s.onRequest != nil:
+		result, err = s.onRequest(context.Background(), req.Method, req.Params)
+	default:
+		err = wireError(CodeMethodNotFound, fmt.Sprintf("method %s not supported by gateway", req.Method))
+	}
+
+	resp := &jsonrpc.Response{ID: req.ID, Error: err}
+	if err == nil {
+		if resp.Result, err = json.Marshal(result); err != nil {
+			resp.Error = wireError(CodeInternalError, err.Error())
+		}
+	}
+
+	if err := s.conn.Write(context.Background(), resp); err != nil {
+		log.Printf("Failed to answer %s request from server %s: %v", req.Method, s.name, err)
+	}
+}
+
+// call sends a request and waits for its response, the context to end or the session to close
+func (s *session) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s params: %w", method, err)
+	}
+	if raw, err = withProgressToken(ctx, raw); err != nil {
+		return fmt.Errorf("failed to attach progress token to %s: %w", method, err)
+	}
+
+	n := s.nextID.Add(1)
+	id, err := jsonrpc.MakeID(float64(n))
+	if err != nil {
+		return err
+	}
+
+	ch := make(chan *jsonrpc.Response, 1)
+	s.pendingMux.Lock()
+	s.pending[n] = ch
+	s.pendingMux.Unlock()
+
+	if err := s.conn.Write(ctx, &jsonrpc.Request{ID: id, Method: method, Params: raw}); err != nil {
+		s.forget(n)
+		return fmt.Errorf("failed to write to server %s: %w", s.name, err)
+	}
+
+	select {
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		if result == nil {
+			return nil
+		}
+		if err := json.Unmarshal(resp.Result, result); err != nil {
+			return fmt.Errorf("failed to parse %s response: %w", method, err)
+		}
+		return nil
+	case <-ctx.Done():
+		s.forget(n)
+		// The server may still be working on it; the handshake itself must not be cancelled
+		if method != "initialize" {
+			go s.cancel(n, ctx.Err())
+		}
+		return ctx.Err()
+	case <-s.done:
+		return fmt.Errorf("%s on server %s: %w", method, s.name, s.err)
+	}
+}
+
+// cancel tells the server to stop working on a request the gateway gave up on
+func (s *session) cancel(id int64, cause error) {
+	reason := "request cancelled by the client"
+	if errors.Is(cause, context.DeadlineExceeded) {
+		reason = "request timed out"
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), cancelTimeout)
+	defer cancel()
+	if err := s.notify(ctx, "notifications/cancelled", &mcpsdk.CancelledParams{RequestID: id, Reason: reason}); err != nil {
+		log.Printf("Failed to cancel request %d on server %s: %v", id, s.name, err)
+	}
+}
+
+// forget removes a request from the pending table
+func (s *session) forget(id int64) {
+	s.pendingMux.Lock()
+	delete(s.pending, id)
+	s.pendingMux.Unlock()
+}
+
+// notify sends a notification to the child server
+func (s *session) notify(ctx context.Context, method string, params interface{}) error {
+	raw, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s params: %w", method, err)
+	}
+
+	if err := s.conn.Write(ctx, &jsonrpc.Request{Method: method, Params: raw}); err != nil {
+		return fmt.Errorf("failed to write to server %s: %w", s.name, err)
+	}
+	return nil
+}
+
+// close closes the connection and fails every pending call
+func (s *session) close() error {
+	err := s.conn.Close()
+	s.shutdown(ErrSessionClosed)
+	return err
+}
+
+// shutdown marks the session as finished
+func (s *session) shutdown(err error) {
+	s.closeMu.Do(func() {
+		if errors.Is(err, io.EOF) || errors.Is(err, mcpsdk.ErrConnectionClosed) {
+			err = ErrSessionClosed
+		}
+		s.err = err
+		close(s.done)
+	})
+}
+
+// wireError builds a JSON-RPC error carrying an error code. The SDK does not export
+// a constructor for coded errors, so one is decoded from its wire form.
+func wireError(code int64, message string) error {
+	data, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      0,
+		"error":   map[string]interface{}{"code": code, "message": message},
+	})
+	if err != nil {
+		return errors.New(message)
+	}
+
+	msg, err := jsonrpc.DecodeMessage(data)
+	if err != nil {
+		return errors.New(message)
+	}
+	if resp, ok := msg.(*jsonrpc.Response); ok && resp.Error != nil {
+		return resp.Error
+	}
+	return errors.New(message)
+}
+
+// stdioConn is a line-framed JSON-RPC connection over a child process's stdin and stdout
+type stdioConn struct {
+	name    string
+	reader  *bufio.Reader
+	writer  io.WriteCloser
+	closer  io.Closer
+	onNoise func(line string)
+
+	writeMu sync.Mutex
+}
+
+// newStdioConn wraps a process's pipes as a connection. Stdout lines that are
+// not JSON-RPC are passed to onNoise, or logged if it is nil.
+func newStdioConn(name string, stdin io.WriteCloser, stdout io.ReadCloser, onNoise func(line string)) *stdioConn {
+	return &stdioConn{
+		name:    name,
+		reader:  bufio.NewReader(stdout),
+		writer:  stdin,
+		closer:  stdout,
+		onNoise: onNoise,
+	}
+}
+
+// Read returns the next JSON-RPC message. Lines that are not valid JSON-RPC,
+// such as stray log output on stdout, are skipped.
+func (c *stdioConn) Read(ctx context.Context) (jsonrpc.Message, error) {
+	for {
+		line, err := c.reader.ReadBytes('\n')
+		if err != nil {
+			if len(line) == 0 {
+				return nil, err
+			}
+		}
+
+		if msg, decodeErr := jsonrpc.DecodeMessage(line); decodeErr == nil {
+			return msg, nil
+		} else if len(bytes.TrimSpace(line)) > 0 {
+			if c.onNoise != nil {
+				c.onNoise(string(line))
+			} else {
+				log.Printf("Ignoring non-protocol output from server %s: %.200s", c.name, line)
+			}
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Write encodes a message on a single line
+func (c *stdioConn) Write(ctx context.Context, msg jsonrpc.Message) error {
+	data, err := jsonrpc.EncodeMessage(msg)
+	if err != nil {
+		return fmt.Errorf("failed to encode message: %w", err)
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	_, err = c.writer.Write(append(data, '\n'))
+	return err
+}
+
+// Close closes both pipes
+func (c *stdioConn) Close() error {
+	err := c.writer.Close()
+	if closeErr := c.closer.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// SessionID is empty for stdio connections
+func (c *stdioConn) SessionID() string { return "" }
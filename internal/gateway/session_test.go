@@ -0,0 +1,201 @@
+package gateway
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+)
+
+// fakeChild is the server end of a stdio connection, driven by the test
+type fakeChild struct {
+	t      *testing.T
+	reader *bufio.Reader
+	writer io.WriteCloser
+}
+
+// newPipeSession connects a session to a fake child over in-memory pipes
+func newPipeSession(t *testing.T, onNotification NotificationHandler, onRequest RequestHandler) (*session, *fakeChild) {
+	t.Helper()
+	toChild, childIn := io.Pipe()
+	childOut, fromChild := io.Pipe()
+
+	conn := newStdioConn("fake", childIn, childOut, func(string) {})
+	sess := newSession("fake", conn, onNotification, onRequest)
+	t.Cleanup(func() {
+		sess.close()
+		fromChild.Close()
+		toChild.Close()
+	})
+	return sess, &fakeChild{t: t, reader: bufio.NewReader(toChild), writer: fromChild}
+}
+
+// read returns the next message the gateway sent
+func (c *fakeChild) read() jsonrpc.Message {
+	c.t.Helper()
+	line, err := c.reader.ReadBytes('\n')
+	if err != nil {
+		c.t.Fatalf("child read: %v", err)
+	}
+	msg, err := jsonrpc.DecodeMessage(line)
+	if err != nil {
+		c.t.Fatalf("child decode %q: %v", line, err)
+	}
+	return msg
+}
+
+// write sends a message, or a raw line, to the gateway
+func (c *fakeChild) write(msg interface{}) {
+	c.t.Helper()
+	var data []byte
+	switch msg := msg.(type) {
+	case string:
+		data = []byte(msg)
+	case jsonrpc.Message:
+		var err error
+		if data, err = jsonrpc.EncodeMessage(msg); err != nil {
+			c.t.Fatalf("child encode: %v", err)
+		}
+	}
+	if _, err := c.writer.Write(append(data, '\n')); err != nil {
+		c.t.Fatalf("child write: %v", err)
+	}
+}
+
+func TestSessionMultiplexesOutOfOrderResponses(t *testing.T) {
+	notified := make(chan string, 1)
+	onNotification := func(method string, params json.RawMessage) {
+		notified <- method
+	}
+	onRequest := func(ctx context.Context, method string, params json.RawMessage) (interface{}, error) {
+		if method != "roots/list" {
+			return nil, wireError(CodeMethodNotFound, method)
+		}
+		return map[string]interface{}{"roots": []interface{}{}}, nil
+	}
+	sess, child := newPipeSession(t, onNotification, onRequest)
+
+	// Two calls in flight at once, as from two clients
+	type outcome struct {
+		Echo string `json:"echo"`
+	}
+	results := make([]outcome, 2)
+	errs := make([]error, 2)
+	var wg sync.WaitGroup
+	for i, text := range []string{"first", "second"} {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			errs[i] = sess.call(context.Background(), "tools/call", map[string]string{"text": text}, &results[i])
+		}(i, text)
+	}
+
+	// The child sees two requests with distinct gateway-assigned ids
+	var requests []*jsonrpc.Request
+	for len(requests) < 2 {
+		req, ok := child.read().(*jsonrpc.Request)
+		if !ok || !req.ID.IsValid() {
+			t.Fatal("child expected a call")
+		}
+		requests = append(requests, req)
+	}
+	if requests[0].ID == requests[1].ID {
+		t.Fatalf("both calls got id %v", requests[0].ID.Raw())
+	}
+
+	// Stray output, a notification and a request of its own before answering
+	child.write("npm WARN this is not JSON-RPC")
+	child.write(&jsonrpc.Request{Method: "notifications/tools/list_changed"})
+	serverID, _ := jsonrpc.MakeID("server-1")
+	child.write(&jsonrpc.Request{ID: serverID, Method: "roots/list"})
+
+	resp, ok := child.read().(*jsonrpc.Response)
+	if !ok || resp.ID != serverID || resp.Error != nil {
+		t.Fatalf("child got %+v, want the answer to its roots/list request", resp)
+	}
+	select {
+	case method := <-notified:
+		if method != "notifications/tools/list_changed" {
+			t.Errorf("notification %s, want notifications/tools/list_changed", method)
+		}
+	case <-time.After(time.Second):
+		t.Error("notification was not dispatched")
+	}
+
+	// Answer in reverse order, echoing each request's own text
+	for i := len(requests) - 1; i >= 0; i-- {
+		var params map[string]string
+		if err := json.Unmarshal(requests[i].Params, &params); err != nil {
+			t.Fatal(err)
+		}
+		result, _ := json.Marshal(outcome{Echo: params["text"]})
+		child.write(&jsonrpc.Response{ID: requests[i].ID, Result: result})
+	}
+	wg.Wait()
+
+	for i, want := range []string{"first", "second"} {
+		if errs[i] != nil {
+			t.Errorf("call %d failed: %v", i, errs[i])
+		} else if results[i].Echo != want {
+			t.Errorf("call %d got the response to %q", i, results[i].Echo)
+		}
+	}
+}
+
+func TestSessionFailsPendingCallsOnClose(t *testing.T) {
+	sess, child := newPipeSession(t, nil, nil)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.call(context.Background(), "tools/call", struct{}{}, nil)
+	}()
+	child.read()
+
+	child.writer.Close()
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrSessionClosed) {
+			t.Errorf("call failed with %v, want ErrSessionClosed", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("pending call did not fail when the child went away")
+	}
+}
+
+func TestSessionCancelsAbandonedCalls(t *testing.T) {
+	sess, child := newPipeSession(t, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- sess.call(ctx, "tools/call", struct{}{}, nil)
+	}()
+	req := child.read().(*jsonrpc.Request)
+	cancel()
+
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("call failed with %v, want context.Canceled", err)
+	}
+	note, ok := child.read().(*jsonrpc.Request)
+	if !ok || note.Method != "notifications/cancelled" {
+		t.Fatalf("child got %+v, want notifications/cancelled", note)
+	}
+	var params struct {
+		RequestID float64 `json:"requestId"`
+	}
+	if err := json.Unmarshal(note.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.RequestID != float64(req.ID.Raw().(int64)) {
+		t.Errorf("cancelled request %v, want %v", params.RequestID, req.ID.Raw())
+	}
+
+	// A late response to the abandoned call is dropped
+	child.write(&jsonrpc.Response{ID: req.ID, Result: json.RawMessage(`{}`)})
+}
@@ -0,0 +1,158 @@
+package gateway
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// templateValues resolve the templates in the args and env of a server:
+//
+//	${cred:NAME}    a credential of the server
+//	${config:name}  a value of the server's "config" section
+//	${env:NAME}     a variable of the gateway's environment
+//	${mcpdir}       the OneMCP data directory
+//
+// "$${" stands for a literal "${". Problems are collected rather than returned,
+// so that one error can name every undefined reference.
+type templateValues struct {
+	creds    map[string]string
+	config   map[string]interface{}
+	mcpDir   string
+	problems []string
+}
+
+// expandArgs resolves the templates in arguments. An argument consisting of just a
+// reference to a list config value becomes one argument per item.
+func (v *templateValues) expandArgs(args []string) []string {
+	expanded := make([]string, 0, len(args))
+	for _, arg := range args {
+		if name, ok := wholeConfigRef(arg); ok {
+			if items, ok := v.config[name].([]interface{}); ok {
+				for _, item := range items {
+					value, err := configValue(item)
+					if err != nil {
+						v.problems = append(v.problems, fmt.Sprintf("%s: %v", arg, err))
+					}
+					expanded = append(expanded, value)
+				}
+				continue
+			}
+		}
+		expanded = append(expanded, v.expand(arg))
+	}
+	return expanded
+}
+
+// expand resolves the templates in text
+func (v *templateValues) expand(text string) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(text, "${")
+		if start < 0 {
+			out.WriteString(text)
+			return out.String()
+		}
+		if start > 0 && text[start-1] == '$' {
+			out.WriteString(text[:start-1] + "${")
+			text = text[start+2:]
+			continue
+		}
+
+		end := strings.IndexByte(text[start:], '}')
+		if end < 0 {
+			v.problems = append(v.problems, fmt.Sprintf("unterminated reference %q", text[start:]))
+			out.WriteString(text)
+			return out.String()
+		}
+
+		ref := text[start+2 : start+end]
+		out.WriteString(text[:start])
+		out.WriteString(v.lookup(ref))
+		text = text[start+end+1:]
+	}
+}
+
+// lookup returns the value of a reference, recording a problem if it has none
+func (v *templateValues) lookup(ref string) string {
+	if ref == "mcpdir" {
+		return v.mcpDir
+	}
+
+	kind, name, _ := strings.Cut(ref, ":")
+	switch kind {
+	case "cred":
+		if value, ok := v.creds[name]; ok {
+			return value
+		}
+	case "env":
+		if value, ok := os.LookupEnv(name); ok {
+			return value
+		}
+	case "config":
+		if raw, ok := v.config[name]; ok {
+			value, err := configValue(raw)
+			if err != nil {
+				v.problems = append(v.problems, fmt.Sprintf("${%s}: %v", ref, err))
+			}
+			return value
+		}
+	default:
+		v.problems = append(v.problems, fmt.Sprintf("unknown reference ${%s}", ref))
+		return ""
+	}
+
+	v.problems = append(v.problems, fmt.Sprintf("undefined reference ${%s}", ref))
+	return ""
+}
+
+// err returns the problems found while expanding, if any
+func (v *templateValues) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{Err: fmt.Errorf("invalid templates in args or env: %s", strings.Join(v.problems, "; "))}
+}
+
+// ConfigError reports a server configuration that cannot work as it is, such as
+// one with an undefined template reference. Restarting the server cannot help, so
+// it is marked as errored at once.
+type ConfigError struct {
+	Err error
+}
+
+func (e *ConfigError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// wholeConfigRef reports whether arg is exactly a ${config:name} reference
+func wholeConfigRef(arg string) (string, bool) {
+	ref, ok := strings.CutPrefix(arg, "${config:")
+	if !ok || !strings.HasSuffix(ref, "}") || strings.Contains(ref, "${") {
+		return "", false
+	}
+	return strings.TrimSuffix(ref, "}"), true
+}
+
+// configValue formats a plain config value. Lists only fit whole arguments.
+func configValue(value interface{}) (string, error) {
+	switch value := value.(type) {
+	case string:
+		return value, nil
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64), nil
+	case bool:
+		return strconv.FormatBool(value), nil
+	case nil:
+		return "", nil
+	case []interface{}:
+		return "", fmt.Errorf("a list can only stand for a whole argument")
+	default:
+		return "", fmt.Errorf("not a plain value")
+	}
+}
@@ -0,0 +1,121 @@
+package gateway
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+)
+
+func TestTemplateExpansion(t *testing.T) {
+	t.Setenv("ONEMCP_TEST_HOME", "/home/test")
+
+	tests := []struct {
+		name    string
+		args    []string
+		want    []string
+		problem string // expected in the error, if any
+	}{
+		{"credential", []string{"--token=${cred:TOKEN}"}, []string{"--token=secret"}, ""},
+		{"config string", []string{"${config:root}/data"}, []string{"/srv/data"}, ""},
+		{"config number and bool", []string{"${config:port}", "${config:debug}"}, []string{"8080", "true"}, ""},
+		{"config list as whole args", []string{"--", "${config:dirs}"}, []string{"--", "/a", "/b"}, ""},
+		{"environment", []string{"${env:ONEMCP_TEST_HOME}/.cache"}, []string{"/home/test/.cache"}, ""},
+		{"data directory", []string{"${mcpdir}/cache"}, []string{"/mcp/cache"}, ""},
+		{"several in one", []string{"${cred:TOKEN}@${config:root}"}, []string{"secret@/srv"}, ""},
+		{"escaped", []string{"$${cred:TOKEN}"}, []string{"${cred:TOKEN}"}, ""},
+		{"no templates", []string{"plain", "$HOME"}, []string{"plain", "$HOME"}, ""},
+		{"undefined credential", []string{"${cred:MISSING}"}, nil, "undefined reference ${cred:MISSING}"},
+		{"undefined config", []string{"${config:missing}"}, nil, "undefined reference ${config:missing}"},
+		{"undefined environment", []string{"${env:ONEMCP_TEST_UNSET}"}, nil, "undefined reference ${env:ONEMCP_TEST_UNSET}"},
+		{"unknown scheme", []string{"${vault:TOKEN}"}, nil, "unknown reference ${vault:TOKEN}"},
+		{"list inside text", []string{"--dirs=${config:dirs}"}, nil, "a list can only stand for a whole argument"},
+		{"unterminated", []string{"${cred:TOKEN"}, nil, "unterminated reference"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values := &templateValues{
+				creds: map[string]string{"TOKEN": "secret"},
+				config: map[string]interface{}{
+					"root":  "/srv",
+					"port":  float64(8080),
+					"debug": true,
+					"dirs":  []interface{}{"/a", "/b"},
+				},
+				mcpDir: "/mcp",
+			}
+
+			got := values.expandArgs(tt.args)
+			err := values.err()
+			if tt.problem != "" {
+				var configErr *ConfigError
+				if !errors.As(err, &configErr) || !strings.Contains(err.Error(), tt.problem) {
+					t.Fatalf("error = %v, want a ConfigError mentioning %q", err, tt.problem)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandArgs(%q) = %q, want %q", tt.args, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateProblemsNamedTogether(t *testing.T) {
+	values := &templateValues{}
+	values.expandArgs([]string{"${cred:A}"})
+	values.expand("${env:ONEMCP_TEST_UNSET}")
+
+	err := values.err()
+	if err == nil || !strings.Contains(err.Error(), "${cred:A}") || !strings.Contains(err.Error(), "${env:ONEMCP_TEST_UNSET}") {
+		t.Errorf("error = %v, want both undefined references named", err)
+	}
+}
+
+func TestUndefinedReferenceFailsBeforeSpawn(t *testing.T) {
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveServerConfig(&storage.ServerConfig{
+		Name:    "templated",
+		Type:    storage.ServerTypeCustom,
+		Status:  storage.StatusInstalled,
+		Command: filepath.Join(t.TempDir(), "never-run"),
+		Args:    []string{"--token", "${cred:API_TOKEN}"},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	gw := NewGateway(config.DefaultConfig(), store)
+	err = gw.StartServer("templated")
+	var configErr *ConfigError
+	if !errors.As(err, &configErr) || !strings.Contains(err.Error(), "${cred:API_TOKEN}") {
+		t.Fatalf("StartServer error = %v, want a ConfigError naming ${cred:API_TOKEN}", err)
+	}
+
+	// The error is permanent: the server is marked as errored instead of restarted
+	process := gw.servers["templated"]
+	if !process.Crashed() {
+		t.Error("the server was not marked as errored")
+	}
+	gw.scheduleRestart(process, true)
+	if process.restart.pending {
+		t.Error("a restart was scheduled for a server that cannot start")
+	}
+	saved, err := store.LoadServerConfig("templated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if saved.Status != storage.StatusError {
+		t.Errorf("stored status = %s, want %s", saved.Status, storage.StatusError)
+	}
+}
@@ -0,0 +1,75 @@
+package gateway
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// defaultRequestTimeout bounds proxied requests when neither the tool, the server
+// nor the gateway configuration sets a timeout
+const defaultRequestTimeout = 2 * time.Minute
+
+// ErrRequestTimeout is returned when a server does not answer a proxied request in time
+var ErrRequestTimeout = errors.New("request timed out")
+
+// requestTimeout returns the timeout of a request to a server, for a tool call if
+// tool is set. Zero means no timeout.
+func (g *Gateway) requestTimeout(process *ServerProcess, tool string) time.Duration {
+	serverConfig := process.Config
+	if value, ok := serverConfig.ToolTimeouts[tool]; ok && tool != "" {
+		return configDuration(serverConfig, "timeout of tool "+tool, value, g.gatewayTimeout())
+	}
+	if serverConfig.RequestTimeout != "" {
+		return configDuration(serverConfig, "request_timeout", serverConfig.RequestTimeout, g.gatewayTimeout())
+	}
+	return g.gatewayTimeout()
+}
+
+// gatewayTimeout returns the gateway-wide request timeout
+func (g *Gateway) gatewayTimeout() time.Duration {
+	value := g.config.Gateway.RequestTimeout
+	if value == "" {
+		return defaultRequestTimeout
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return defaultRequestTimeout
+	}
+	return d
+}
+
+// forward sends a client request to a server through request, first starting the
+// server if it is started on demand. The request is cancelled at the server when
+// it times out or the client cancels it.
+func (g *Gateway) forward(ctx context.Context, process *ServerProcess, tool string, request func(ctx context.Context) error) error {
+	// A restart holding the server finishes before it is started on first use
+	client := clientFrom(ctx)
+	if err := process.begin(ctx, client); err != nil {
+		return err
+	}
+	defer process.end(client)
+
+	if err := g.activate(process); err != nil {
+		return err
+	}
+
+	ctx, release := g.trackProgress(ctx, process)
+	defer release()
+
+	timeout := g.requestTimeout(process, tool)
+	if timeout <= 0 {
+		return request(ctx)
+	}
+
+	requestCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	err := request(requestCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(requestCtx.Err(), context.DeadlineExceeded) {
+		return fmt.Errorf("%w: server %s did not answer within %s", ErrRequestTimeout, process.Name, timeout)
+	}
+	return err
+}
@@ -0,0 +1,179 @@
+package gateway
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	"github.com/modelcontextprotocol/go-sdk/jsonrpc"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newPipeGateway returns a gateway with a single running server, played by a fake child
+func newPipeGateway(t *testing.T, cfg *config.Config, serverConfig *storage.ServerConfig) (*Gateway, *ServerProcess, *fakeChild) {
+	t.Helper()
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewGateway(cfg, store)
+	process, child := addPipeServer(t, g, serverConfig)
+	return g, process, child
+}
+
+// readRequest reads the next message of the gateway, which must be a request for method
+func (c *fakeChild) readRequest(method string) *jsonrpc.Request {
+	c.t.Helper()
+	req, ok := c.read().(*jsonrpc.Request)
+	if !ok || req.Method != method {
+		c.t.Fatalf("child got %#v; want a %s request", req, method)
+	}
+	return req
+}
+
+// readCancelled reads the notification that cancels req and returns its reason
+func (c *fakeChild) readCancelled(req *jsonrpc.Request) string {
+	c.t.Helper()
+	msg := c.readRequest("notifications/cancelled")
+	var params mcpsdk.CancelledParams
+	if err := json.Unmarshal(msg.Params, &params); err != nil {
+		c.t.Fatal(err)
+	}
+	if fmt.Sprint(params.RequestID) != fmt.Sprint(req.ID.Raw()) {
+		c.t.Errorf("cancelled request %v; want %v", params.RequestID, req.ID.Raw())
+	}
+	return params.Reason
+}
+
+func TestRequestTimeoutPrecedence(t *testing.T) {
+	tests := []struct {
+		name    string
+		gateway string
+		server  string
+		tools   map[string]string
+		tool    string
+		want    time.Duration
+	}{
+		{name: "default", want: defaultRequestTimeout},
+		{name: "gateway", gateway: "30s", want: 30 * time.Second},
+		{name: "gateway disabled", gateway: "0", want: 0},
+		{name: "invalid gateway", gateway: "soon", want: defaultRequestTimeout},
+		{name: "negative gateway", gateway: "-1s", want: defaultRequestTimeout},
+		{name: "server over gateway", gateway: "30s", server: "10s", want: 10 * time.Second},
+		{name: "server disables", gateway: "30s", server: "0", want: 0},
+		{name: "invalid server", gateway: "30s", server: "soon", want: 30 * time.Second},
+		{name: "tool over server", gateway: "30s", server: "10s", tools: map[string]string{"build": "5m"}, tool: "build", want: 5 * time.Minute},
+		{name: "other tool", gateway: "30s", server: "10s", tools: map[string]string{"build": "5m"}, tool: "search", want: 10 * time.Second},
+		{name: "tool without server", gateway: "30s", tools: map[string]string{"build": "5m"}, tool: "build", want: 5 * time.Minute},
+		{name: "invalid tool", gateway: "30s", server: "10s", tools: map[string]string{"build": "soon"}, tool: "build", want: 30 * time.Second},
+		{name: "not a tool call", gateway: "30s", server: "10s", tools: map[string]string{"": "5m"}, want: 10 * time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.DefaultConfig()
+			cfg.Gateway.RequestTimeout = tt.gateway
+			g := &Gateway{config: cfg}
+			process := newTestProcess("github")
+			process.Config.RequestTimeout = tt.server
+			process.Config.ToolTimeouts = tt.tools
+
+			if got := g.requestTimeout(process, tt.tool); got != tt.want {
+				t.Errorf("requestTimeout(%q) = %v; want %v", tt.tool, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardTimesOutAndCancelsAtServer(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Gateway.RequestTimeout = "1h"
+	g, _, child := newPipeGateway(t, cfg, &storage.ServerConfig{
+		Name:           "github",
+		RequestTimeout: "1h",
+		ToolTimeouts:   map[string]string{"search": "50ms"},
+	})
+
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.CallTool(context.Background(), "github__search", json.RawMessage(`{}`))
+		errc <- err
+	}()
+
+	req := child.readRequest("tools/call")
+	if reason := child.readCancelled(req); reason != "request timed out" {
+		t.Errorf("cancel reason = %q; want request timed out", reason)
+	}
+
+	err := <-errc
+	if !errors.Is(err, ErrRequestTimeout) {
+		t.Fatalf("CallTool = %v; want ErrRequestTimeout", err)
+	}
+	if !strings.Contains(err.Error(), "server github did not answer within 50ms") {
+		t.Errorf("CallTool error %q does not name the server and the tool timeout", err)
+	}
+
+	// A late answer to the cancelled request is dropped
+	child.write(&jsonrpc.Response{ID: req.ID, Result: json.RawMessage(`{"content":[]}`)})
+}
+
+func TestForwardPassesClientCancelToServer(t *testing.T) {
+	g, _, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errc := make(chan error, 1)
+	go func() {
+		_, err := g.CallTool(ctx, "github__search", json.RawMessage(`{}`))
+		errc <- err
+	}()
+
+	req := child.readRequest("tools/call")
+	cancel()
+	if reason := child.readCancelled(req); reason != "request cancelled by the client" {
+		t.Errorf("cancel reason = %q; want request cancelled by the client", reason)
+	}
+
+	err := <-errc
+	if !errors.Is(err, context.Canceled) || errors.Is(err, ErrRequestTimeout) {
+		t.Errorf("CallTool = %v; want the client's cancellation, not a timeout", err)
+	}
+}
+
+func TestForwardAnswersWithinTimeout(t *testing.T) {
+	g, _, child := newPipeGateway(t, config.DefaultConfig(), &storage.ServerConfig{Name: "github", RequestTimeout: "1h"})
+
+	type answer struct {
+		result *mcpsdk.CallToolResult
+		err    error
+	}
+	answers := make(chan answer, 1)
+	go func() {
+		result, err := g.CallTool(context.Background(), "github__search", json.RawMessage(`{"q":"onemcp"}`))
+		answers <- answer{result, err}
+	}()
+
+	req := child.readRequest("tools/call")
+	var params mcpsdk.CallToolParamsRaw
+	if err := json.Unmarshal(req.Params, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Name != "search" || string(params.Arguments) != `{"q":"onemcp"}` {
+		t.Errorf("server got tool %q with %s; want search with the client's arguments", params.Name, params.Arguments)
+	}
+	child.write(&jsonrpc.Response{ID: req.ID, Result: json.RawMessage(`{"content":[{"type":"text","text":"found"}]}`)})
+
+	got := <-answers
+	if got.err != nil {
+		t.Fatalf("CallTool: %v", got.err)
+	}
+	if len(got.result.Content) != 1 {
+		t.Errorf("CallTool content = %v; want the server's answer", got.result.Content)
+	}
+}
@@ -31,6 +31,8 @@ type InstallResult struct {
 	Package     string
 	Version     string
 	InstallPath string
+	Command     string // launches the installed server, with Args
+	Args        []string
 	Success     bool
 	Error       string
 }
@@ -67,7 +69,7 @@ func (i *Installer) InstallFromNPM(packageName string) (*InstallResult, error) {
 	}
 
 	// Find the binary/script path
-	binPath, err := i.findNPMBinary(packageName, installDir)
+	command, err := i.findNPMBinary(packageName, installDir)
 	if err != nil {
 		return &InstallResult{
 			Success: false,
@@ -80,7 +82,9 @@ func (i *Installer) InstallFromNPM(packageName string) (*InstallResult, error) {
 		Type:        storage.ServerTypeNPM,
 		Package:     packageName,
 		Version:     version,
-		InstallPath: binPath,
+		InstallPath: strings.Join(command, " "),
+		Command:     command[0],
+		Args:        command[1:],
 		Success:     true,
 	}, nil
 }
@@ -134,6 +138,8 @@ func (i *Installer) InstallFromPIP(packageName string) (*InstallResult, error) {
 		Package:     packageName,
 		Version:     version,
 		InstallPath: entryPoint,
+		Command:     "python3",
+		Args:        []string{entryPoint},
 		Success:     true,
 	}, nil
 }
@@ -203,7 +209,7 @@ func (i *Installer) getNPMVersion(packageName, installDir string) (string, error
 }
 
 // findNPMBinary finds the binary path for an npm package
-func (i *Installer) findNPMBinary(packageName, installDir string) (string, error) {
+func (i *Installer) findNPMBinary(packageName, installDir string) ([]string, error) {
 	binDir := filepath.Join(installDir, "bin")
 	if runtime.GOOS == "windows" {
 		binDir = filepath.Join(installDir, "bin")
@@ -224,13 +230,13 @@ func (i *Installer) findNPMBinary(packageName, installDir string) (string, error
 					fullPath += ".cmd"
 				}
 				if _, err := os.Stat(fullPath); err == nil {
-					return fullPath, nil
+					return []string{fullPath}, nil
 				}
 
 				// Check direct path
 				fullPath = filepath.Join(installDir, "lib", "node_modules", packageName, binPath)
 				if _, err := os.Stat(fullPath); err == nil {
-					return fmt.Sprintf("node %s", fullPath), nil
+					return []string{"node", fullPath}, nil
 				}
 			}
 		}
@@ -252,11 +258,11 @@ func (i *Installer) findNPMBinary(packageName, installDir string) (string, error
 		}
 
 		if _, err := os.Stat(binPath); err == nil {
-			return binPath, nil
+			return []string{binPath}, nil
 		}
 	}
 
-	return "", fmt.Errorf("could not find binary for package %s", packageName)
+	return nil, fmt.Errorf("could not find binary for package %s", packageName)
 }
 
 // getPIPVersion gets the version of an installed pip package
@@ -366,6 +372,8 @@ func (i *Installer) installFromGit(repoURL string) (*InstallResult, error) {
 			Package:     repoURL,
 			Version:     "git",
 			InstallPath: filepath.Join(installDir, "index.js"), // Assume main file
+			Command:     "node",
+			Args:        []string{filepath.Join(installDir, "index.js")},
 			Success:     true,
 		}, nil
 	} else if _, err := os.Stat(filepath.Join(installDir, "setup.py")); err == nil {
@@ -385,6 +393,8 @@ func (i *Installer) installFromGit(repoURL string) (*InstallResult, error) {
 			Package:     repoURL,
 			Version:     "git",
 			InstallPath: fmt.Sprintf("python3 -m %s", repoName),
+			Command:     "python3",
+			Args:        []string{"-m", repoName},
 			Success:     true,
 		}, nil
 	}
@@ -426,6 +436,8 @@ func (i *Installer) installFromLocal(localPath string) (*InstallResult, error) {
 			Package:     localPath,
 			Version:     "local",
 			InstallPath: filepath.Join(absPath, "index.js"),
+			Command:     "node",
+			Args:        []string{filepath.Join(absPath, "index.js")},
 			Success:     true,
 		}, nil
 	}
@@ -447,6 +459,8 @@ func (i *Installer) installFromLocal(localPath string) (*InstallResult, error) {
 			Package:     localPath,
 			Version:     "local",
 			InstallPath: fmt.Sprintf("python3 -m %s", repoName),
+			Command:     "python3",
+			Args:        []string{"-m", repoName},
 			Success:     true,
 		}, nil
 	}
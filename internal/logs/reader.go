@@ -0,0 +1,373 @@
+package logs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Log levels, from least to most severe. Levels are inferred from the text of a line.
+const (
+	LevelDebug = "debug"
+	LevelInfo  = "info"
+	LevelWarn  = "warn"
+	LevelError = "error"
+)
+
+var levelRank = map[string]int{LevelDebug: 0, LevelInfo: 1, LevelWarn: 2, LevelError: 3}
+
+var levelPatterns = []struct {
+	level   string
+	pattern *regexp.Regexp
+}{
+	{LevelError, regexp.MustCompile(`(?i)\b(error|err|fatal|panic|critical|exception|exited with error)\b`)},
+	{LevelWarn, regexp.MustCompile(`(?i)\b(warn|warning)\b`)},
+	{LevelDebug, regexp.MustCompile(`(?i)\b(debug|trace)\b`)},
+}
+
+// Entry is one line of a server log
+type Entry struct {
+	Server string
+	Time   time.Time
+	Stream string
+	Text   string
+}
+
+// Level infers the severity of the entry from its text
+func (e *Entry) Level() string {
+	for _, p := range levelPatterns {
+		if p.pattern.MatchString(e.Text) {
+			return p.level
+		}
+	}
+	return LevelInfo
+}
+
+// ParseLine parses a line written by Writer. Lines in another format are kept
+// whole as text without a timestamp.
+func ParseLine(server, line string) *Entry {
+	line = strings.TrimRight(line, "\r\n")
+
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) == 3 {
+		if t, err := time.Parse(TimeFormat, fields[0]); err == nil {
+			return &Entry{Server: server, Time: t, Stream: fields[1], Text: fields[2]}
+		}
+	}
+	return &Entry{Server: server, Text: line}
+}
+
+// ValidLevel reports whether level names a known log level
+func ValidLevel(level string) bool {
+	_, ok := levelRank[level]
+	return ok
+}
+
+// Filter selects log entries
+type Filter struct {
+	Since time.Time      // entries before this time are dropped, if set
+	Grep  *regexp.Regexp // entries must match, if set
+	Level string         // minimum level, if set
+}
+
+// Match reports whether the entry passes the filter
+func (f *Filter) Match(e *Entry) bool {
+	if f == nil {
+		return true
+	}
+	if !f.Since.IsZero() && !e.Time.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if f.Grep != nil && !f.Grep.MatchString(e.Text) {
+		return false
+	}
+	if f.Level != "" && levelRank[e.Level()] < levelRank[f.Level] {
+		return false
+	}
+	return true
+}
+
+// Servers returns the names of the servers that have a log file in dir
+func Servers(dir string) ([]string, error) {
+	matches, err := filepath.Glob(filepath.Join(dir, "*.log"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list log files: %w", err)
+	}
+
+	servers := make([]string, 0, len(matches))
+	for _, match := range matches {
+		servers = append(servers, strings.TrimSuffix(filepath.Base(match), ".log"))
+	}
+	sort.Strings(servers)
+	return servers, nil
+}
+
+// Read returns the matching entries of a server's log, including rotated files, oldest first
+func Read(server, path string, filter *Filter) ([]*Entry, error) {
+	files, err := rotatedFiles(path)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, path)
+
+	var entries []*Entry
+	for _, file := range files {
+		read, err := readFile(server, file, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	return entries, nil
+}
+
+// rotatedFiles returns the rotated files of the log at path, oldest first
+func rotatedFiles(path string) ([]string, error) {
+	rotated, err := filepath.Glob(path + ".*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list rotated logs: %w", err)
+	}
+
+	// Higher suffixes are older
+	var files []string
+	for i := len(rotated); i >= 1; i-- {
+		name := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(name); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files, nil
+}
+
+// readFile returns the matching entries of one log file; a missing file has none
+func readFile(server, file string, filter *Filter) ([]*Entry, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open log file: %w", err)
+	}
+	defer f.Close()
+
+	var entries []*Entry
+	scanner := newScanner(f)
+	for scanner.Scan() {
+		if entry := ParseLine(server, scanner.Text()); filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read log file: %w", err)
+	}
+	return entries, nil
+}
+
+// Merge interleaves entries from several servers in time order
+func Merge(logs ...[]*Entry) []*Entry {
+	var merged []*Entry
+	for _, entries := range logs {
+		merged = append(merged, entries...)
+	}
+	sort.SliceStable(merged, func(i, j int) bool {
+		return merged[i].Time.Before(merged[j].Time)
+	})
+	return merged
+}
+
+// followInterval is how often followed log files are checked for new lines
+const followInterval = 250 * time.Millisecond
+
+// Follow sends matching lines appended to the server logs in dir until the context
+// is cancelled. With history, the lines already in the logs, rotated files included,
+// are sent first; they are read from the same open files that are then followed,
+// so no line written in between is lost. Logs rotated while being followed are
+// reopened from the start; servers whose log appears later are picked up when
+// all is set.
+func Follow(ctx context.Context, dir string, servers []string, all, history bool, filter *Filter, out chan<- *Entry) error {
+	followers := make(map[string]*follower)
+	add := func(server string) {
+		if _, ok := followers[server]; !ok {
+			followers[server] = &follower{server: server, path: filepath.Join(dir, server+".log")}
+		}
+	}
+	for _, server := range servers {
+		add(server)
+	}
+
+	// Without history, start at the current end of every log
+	for _, f := range followers {
+		f.open(!history)
+	}
+	defer func() {
+		for _, f := range followers {
+			f.close()
+		}
+	}()
+
+	send := func(entries []*Entry) bool {
+		for _, entry := range entries {
+			select {
+			case out <- entry:
+			case <-ctx.Done():
+				return false
+			}
+		}
+		return true
+	}
+
+	if history {
+		var earlier [][]*Entry
+		for _, f := range followers {
+			entries, err := f.history(filter)
+			if err != nil {
+				return err
+			}
+			earlier = append(earlier, entries)
+		}
+		if !send(Merge(earlier...)) {
+			return nil
+		}
+	}
+
+	ticker := time.NewTicker(followInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+
+		if all {
+			current, err := Servers(dir)
+			if err != nil {
+				return err
+			}
+			for _, server := range current {
+				add(server)
+			}
+		}
+
+		var batch []*Entry
+		for _, f := range followers {
+			batch = append(batch, f.poll(filter)...)
+		}
+
+		if !send(Merge(batch)) {
+			return nil
+		}
+	}
+}
+
+// follower tails one log file
+type follower struct {
+	server  string
+	path    string
+	file    *os.File
+	info    os.FileInfo
+	partial string
+}
+
+// open opens the log file, positioned at its end if atEnd is set
+func (f *follower) open(atEnd bool) {
+	file, err := os.Open(f.path)
+	if err != nil {
+		return
+	}
+	if atEnd {
+		file.Seek(0, io.SeekEnd)
+	}
+	f.file = file
+	f.info, _ = file.Stat()
+	f.partial = ""
+}
+
+// close closes the log file
+func (f *follower) close() {
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+}
+
+// history returns the matching lines of the rotated files, followed by those of the
+// open file up to its current end
+func (f *follower) history(filter *Filter) ([]*Entry, error) {
+	files, err := rotatedFiles(f.path)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*Entry
+	for _, file := range files {
+		// A rotation since the log was opened moved the open file aside
+		if info, err := os.Stat(file); err == nil && f.info != nil && os.SameFile(info, f.info) {
+			continue
+		}
+		read, err := readFile(f.server, file, filter)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, read...)
+	}
+	return append(entries, f.read(filter)...), nil
+}
+
+// poll returns the matching complete lines appended since the last poll
+func (f *follower) poll(filter *Filter) []*Entry {
+	if f.file == nil {
+		// The log did not exist yet; everything in it is new
+		f.open(false)
+		if f.file == nil {
+			return nil
+		}
+	} else if info, err := os.Stat(f.path); err == nil && !os.SameFile(info, f.info) {
+		// The log was rotated: finish the old file, then continue with the new one
+		entries := f.read(filter)
+		f.close()
+		f.open(false)
+		return append(entries, f.read(filter)...)
+	}
+
+	return f.read(filter)
+}
+
+// read consumes what is available in the current file
+func (f *follower) read(filter *Filter) []*Entry {
+	if f.file == nil {
+		return nil
+	}
+
+	data, err := io.ReadAll(f.file)
+	if err != nil || len(data) == 0 {
+		return nil
+	}
+
+	text := f.partial + string(data)
+	lines := strings.Split(text, "\n")
+	f.partial = lines[len(lines)-1]
+
+	var entries []*Entry
+	for _, line := range lines[:len(lines)-1] {
+		if entry := ParseLine(f.server, line); filter.Match(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// newScanner returns a line scanner accepting long log lines
+func newScanner(r io.Reader) *bufio.Scanner {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+	return scanner
+}
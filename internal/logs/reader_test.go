@@ -0,0 +1,69 @@
+package logs
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// receive returns the text of the next n entries sent by Follow
+func receive(t *testing.T, entries <-chan *Entry, n int) []string {
+	t.Helper()
+	var texts []string
+	for len(texts) < n {
+		select {
+		case entry := <-entries:
+			texts = append(texts, entry.Text)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got %v, want %d lines", texts, n)
+		}
+	}
+	return texts
+}
+
+func TestFollowWithHistory(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "github.log")
+	if err := os.WriteFile(path+".1", []byte("2025-01-01T10:00:00.000Z stderr rotated\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	w := openWriter(t, path, time.Hour)
+	defer w.Close()
+	w.WriteLine(StreamStderr, "existing")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	entries := make(chan *Entry)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Follow(ctx, dir, []string{"github"}, false, true, nil, entries)
+	}()
+
+	// Lines written while the history is being sent are followed, not lost
+	w.WriteLine(StreamStderr, "appended")
+	got := receive(t, entries, 3)
+	want := []string{"rotated", "existing", "appended"}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+
+	// A rotated log is finished, then followed from the start of the new file
+	w.WriteLine(StreamStderr, "before rotation")
+	if err := w.rotate(); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteLine(StreamStderr, "after rotation")
+	got = receive(t, entries, 2)
+	if got[0] != "before rotation" || got[1] != "after rotation" {
+		t.Errorf("got %v across the rotation", got)
+	}
+
+	cancel()
+	if err := <-errCh; err != nil {
+		t.Errorf("Follow: %v", err)
+	}
+}
@@ -0,0 +1,163 @@
+package logs
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+)
+
+// Streams recorded in server log files
+const (
+	StreamStderr  = "stderr"
+	StreamStdout  = "stdout"
+	StreamGateway = "gateway" // lifecycle events recorded by the gateway itself
+)
+
+// TimeFormat is the timestamp format starting every log line
+const TimeFormat = "2006-01-02T15:04:05.000Z07:00"
+
+// Writer appends timestamped lines to a server's log file, rotating it by size
+// and age. Rotated files are kept as <path>.1 (newest) through <path>.N.
+type Writer struct {
+	path     string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	mu     sync.Mutex
+}
+
+// NewWriter opens the log file at path for appending
+func NewWriter(path string, cfg config.LogsConfig) (*Writer, error) {
+	maxSize := cfg.MaxSizeMB
+	if maxSize <= 0 {
+		maxSize = config.DefaultLogMaxSizeMB
+	}
+	maxAge := cfg.MaxAgeHours
+	if maxAge <= 0 {
+		maxAge = config.DefaultLogMaxAgeHours
+	}
+	maxFiles := cfg.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = config.DefaultLogMaxFiles
+	}
+
+	w := &Writer{
+		path:     path,
+		maxSize:  int64(maxSize) * 1024 * 1024,
+		maxAge:   time.Duration(maxAge) * time.Hour,
+		maxFiles: maxFiles,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// open opens the current log file, continuing an existing one
+func (w *Writer) open() error {
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open log file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("failed to stat log file: %w", err)
+	}
+
+	w.file = file
+	w.size = info.Size()
+	w.opened = time.Now()
+	if w.size > 0 {
+		// An existing file ages from its first line, not from when it was reopened
+		w.opened = started(w.path, info)
+	}
+	return nil
+}
+
+// started returns when the log file at path was started: the timestamp of its
+// first line, or its modification time if that cannot be read
+func started(path string, info os.FileInfo) time.Time {
+	file, err := os.Open(path)
+	if err != nil {
+		return info.ModTime()
+	}
+	defer file.Close()
+
+	head := make([]byte, 64)
+	n, _ := io.ReadFull(file, head)
+	stamp, _, _ := strings.Cut(string(head[:n]), " ")
+	t, err := time.Parse(TimeFormat, stamp)
+	if err != nil {
+		return info.ModTime()
+	}
+	return t
+}
+
+// WriteLine records one line of output from stream
+func (w *Writer) WriteLine(stream, text string) error {
+	line := fmt.Sprintf("%s %s %s\n", time.Now().Format(TimeFormat), stream, strings.TrimRight(text, "\r\n"))
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return os.ErrClosed
+	}
+
+	if w.size > 0 && (w.size+int64(len(line)) > w.maxSize || time.Since(w.opened) > w.maxAge) {
+		if err := w.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := w.file.WriteString(line)
+	w.size += int64(n)
+	return err
+}
+
+// rotate shifts the rotated files up by one, dropping the oldest, and starts a new file
+func (w *Writer) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return fmt.Errorf("failed to close log file: %w", err)
+	}
+	w.file = nil
+
+	os.Remove(fmt.Sprintf("%s.%d", w.path, w.maxFiles))
+	for i := w.maxFiles - 1; i >= 1; i-- {
+		os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+	}
+	renameErr := os.Rename(w.path, w.path+".1")
+
+	// Keep logging to the current file even if it could not be moved aside
+	if err := w.open(); err != nil {
+		return err
+	}
+	if renameErr != nil {
+		return fmt.Errorf("failed to rotate log file: %w", renameErr)
+	}
+	return nil
+}
+
+// Close closes the log file
+func (w *Writer) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
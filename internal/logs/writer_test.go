@@ -0,0 +1,86 @@
+package logs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+)
+
+// openWriter opens a writer on path whose files expire after maxAge
+func openWriter(t *testing.T, path string, maxAge time.Duration) *Writer {
+	t.Helper()
+	w, err := NewWriter(path, config.LogsConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.maxAge = maxAge
+	return w
+}
+
+func TestWriterAgesReopenedFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+
+	w := openWriter(t, path, 200*time.Millisecond)
+	if err := w.WriteLine(StreamStderr, "first"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	// Reopening within the age keeps the file
+	w = openWriter(t, path, 200*time.Millisecond)
+	if err := w.WriteLine(StreamStderr, "second"); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if _, err := os.Stat(path + ".1"); !os.IsNotExist(err) {
+		t.Fatal("the log was rotated before reaching its age")
+	}
+
+	// Reopening keeps the age of the file's first line, so it rotates on time
+	time.Sleep(300 * time.Millisecond)
+	w = openWriter(t, path, 200*time.Millisecond)
+	defer w.Close()
+	if err := w.WriteLine(StreamStderr, "third"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotated, err := os.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatalf("the log was not rotated: %v", err)
+	}
+	if !strings.Contains(string(rotated), "first") || !strings.Contains(string(rotated), "second") {
+		t.Errorf("rotated log = %q, want the first two lines", rotated)
+	}
+	current, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(current), "\n") != 1 || !strings.Contains(string(current), "third") {
+		t.Errorf("current log = %q, want only the third line", current)
+	}
+}
+
+func TestWriterAgesFilesWithoutTimestamps(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "server.log")
+	if err := os.WriteFile(path, []byte("not a log line\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-time.Hour)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	// The modification time stands in for a first line that has no timestamp
+	w := openWriter(t, path, time.Minute)
+	defer w.Close()
+	if err := w.WriteLine(StreamStderr, "line"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path + ".1"); err != nil {
+		t.Errorf("the log was not rotated: %v", err)
+	}
+}
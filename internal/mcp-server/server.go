@@ -3,54 +3,374 @@ package mcp_server
 import (
 	"context"
 	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
 
-	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 	"github.com/mdarshad-ai/OneMCP/internal/config"
 	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
 )
 
 // Server represents the MCP server that aggregates tools from all installed servers
 type Server struct {
 	config *config.Config
 	gw     *gateway.Gateway
+
+	mcpServer  *mcpsdk.Server
+	tools      map[string]*gateway.ToolInfo             // exposed name -> owning server tool
+	prompts    map[string]*gateway.PromptInfo           // exposed name -> owning server prompt
+	resources  map[string]*gateway.ResourceInfo         // exposed URI -> owning server resource
+	templates  map[string]*gateway.ResourceTemplateInfo // exposed URI template -> owning server template
+	collisions []*nameCollision
+	catalogMux sync.Mutex
+}
+
+// nameCollision records an exposed name provided by more than one server
+type nameCollision struct {
+	Kind    string
+	Name    string
+	Servers []string
 }
 
 // NewServer creates a new MCP server
 func NewServer(cfg *config.Config, gw *gateway.Gateway) *Server {
-	fmt.Printf("DEBUG: NewServer called\n")
+	log.Printf("DEBUG: NewServer called")
 	return &Server{
-		config: cfg,
-		gw:     gw,
+		config:    cfg,
+		gw:        gw,
+		tools:     make(map[string]*gateway.ToolInfo),
+		prompts:   make(map[string]*gateway.PromptInfo),
+		resources: make(map[string]*gateway.ResourceInfo),
+		templates: make(map[string]*gateway.ResourceTemplateInfo),
 	}
 }
 
 // CreateMCPServer creates and configures the MCP server
 func (s *Server) CreateMCPServer() *mcpsdk.Server {
-	fmt.Printf("DEBUG: Creating MCP server...\n")
+	log.Printf("DEBUG: Creating MCP server...")
 	server := mcpsdk.NewServer(&mcpsdk.Implementation{
 		Name:    "onemcp",
 		Version: "0.1.0",
-	}, nil)
+	}, &mcpsdk.ServerOptions{
+		SubscribeHandler: func(ctx context.Context, req *mcpsdk.SubscribeRequest) error {
+			return s.gw.SubscribeResource(ctx, req.Params.URI)
+		},
+		UnsubscribeHandler: func(ctx context.Context, req *mcpsdk.UnsubscribeRequest) error {
+			return s.gw.UnsubscribeResource(ctx, req.Params.URI)
+		},
+		CompletionHandler: func(ctx context.Context, req *mcpsdk.CompleteRequest) (*mcpsdk.CompleteResult, error) {
+			return s.gw.Complete(ctx, req.Params)
+		},
+		InitializedHandler: func(ctx context.Context, req *mcpsdk.InitializedRequest) {
+			s.clientConnected(req.Session)
+		},
+		RootsListChangedHandler: func(ctx context.Context, req *mcpsdk.RootsListChangedRequest) {
+			s.gw.RootsChanged()
+		},
+	})
 
-	fmt.Printf("DEBUG: Adding list_servers tool...\n")
+	log.Printf("DEBUG: Adding list_servers tool...")
 	// Add a tool to list all servers
 	mcpsdk.AddTool(server, &mcpsdk.Tool{
 		Name:        "list_servers",
 		Description: "List all installed MCP servers and their status",
 	}, s.ListServers)
 
-	fmt.Printf("DEBUG: MCP server created successfully\n")
+	s.mcpServer = server
+	server.AddReceivingMiddleware(s.activateOnList, attachClient, forwardProgress)
+
+	// Register the catalog of every running server, and keep it in sync
+	s.syncCatalog()
+	s.gw.OnCatalogChange(s.syncCatalog)
+	s.gw.OnResourceUpdated(s.resourceUpdated)
+
+	log.Printf("DEBUG: MCP server created successfully")
 	return server
 }
 
+// activateOnList starts on-demand servers whose catalog is still unknown before a list
+// request is answered, so their tools, prompts and resources are included
+func (s *Server) activateOnList(next mcpsdk.MethodHandler) mcpsdk.MethodHandler {
+	return func(ctx context.Context, method string, req mcpsdk.Request) (mcpsdk.Result, error) {
+		switch method {
+		case "tools/list", "prompts/list", "resources/list", "resources/templates/list":
+			s.gw.ActivateUncataloged(ctx)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// clientConnected lets servers reach a client that completed its handshake, until its session ends
+func (s *Server) clientConnected(session *mcpsdk.ServerSession) {
+	var caps *mcpsdk.ClientCapabilities
+	if params := session.InitializeParams(); params != nil {
+		caps = params.Capabilities
+	}
+	s.gw.AddClient(session, caps)
+
+	go func() {
+		session.Wait()
+		s.gw.RemoveClient(session)
+	}()
+}
+
+// proxied reports whether requests of the method are forwarded to a server
+func proxied(method string) bool {
+	switch method {
+	case "tools/call", "prompts/get", "resources/read", "completion/complete":
+		return true
+	}
+	return false
+}
+
+// attachClient sends the requests a server makes while handling a proxied request,
+// such as sampling, to the client that made it
+func attachClient(next mcpsdk.MethodHandler) mcpsdk.MethodHandler {
+	return func(ctx context.Context, method string, req mcpsdk.Request) (mcpsdk.Result, error) {
+		if session, ok := req.GetSession().(*mcpsdk.ServerSession); ok && proxied(method) {
+			ctx = gateway.WithClient(ctx, session)
+		}
+		return next(ctx, method, req)
+	}
+}
+
+// forwardProgress lets the server handling a proxied request report progress to the
+// client that made it, when the client supplied a progress token
+func forwardProgress(next mcpsdk.MethodHandler) mcpsdk.MethodHandler {
+	return func(ctx context.Context, method string, req mcpsdk.Request) (mcpsdk.Result, error) {
+		if !proxied(method) {
+			return next(ctx, method, req)
+		}
+		params, ok := req.GetParams().(mcpsdk.RequestParams)
+		if !ok {
+			return next(ctx, method, req)
+		}
+		token := params.GetProgressToken()
+		session, ok := req.GetSession().(*mcpsdk.ServerSession)
+		if token == nil || !ok {
+			return next(ctx, method, req)
+		}
+
+		ctx = gateway.WithProgress(ctx, token, func(progress *mcpsdk.ProgressNotificationParams) {
+			if err := session.NotifyProgress(context.Background(), progress); err != nil {
+				log.Printf("Failed to forward progress to client: %v", err)
+			}
+		})
+		return next(ctx, method, req)
+	}
+}
+
+// syncCatalog brings the registered tools, prompts and resources in line with the gateway
+func (s *Server) syncCatalog() {
+	s.catalogMux.Lock()
+	defer s.catalogMux.Unlock()
+
+	s.collisions = nil
+	s.syncTools()
+	s.syncPrompts()
+	s.syncResources()
+}
+
+// uniqueNames groups catalog entries by exposed name. Names provided by exactly one
+// server are returned; the rest are reported as collisions and left out.
+func uniqueNames[T any](kind string, entries []T, key func(T) (string, string), reserved map[string]bool) (map[string]T, []*nameCollision) {
+	owners := make(map[string][]string)
+	unique := make(map[string]T)
+	for _, entry := range entries {
+		name, server := key(entry)
+		owners[name] = append(owners[name], server)
+		unique[name] = entry
+	}
+
+	var collisions []*nameCollision
+	for name, servers := range owners {
+		if reserved[name] {
+			servers = append(servers, "onemcp")
+		}
+		if len(servers) == 1 {
+			continue
+		}
+
+		sort.Strings(servers)
+		delete(unique, name)
+		collisions = append(collisions, &nameCollision{Kind: kind, Name: name, Servers: servers})
+		log.Printf("%s name collision: %s is provided by %s; not registering it (set %q in the server config to rename)",
+			kind, name, strings.Join(servers, ", "), gateway.ToolPrefixKey)
+	}
+
+	return unique, collisions
+}
+
+// syncTools registers newly discovered tools and removes tools whose server went away.
+// Tools whose exposed names collide are reported and left unregistered.
+func (s *Server) syncTools() {
+	wanted, collisions := uniqueNames("Tool", s.gw.ListTools(), func(info *gateway.ToolInfo) (string, string) {
+		return info.Name, info.Server
+	}, map[string]bool{"list_servers": true})
+	s.collisions = append(s.collisions, collisions...)
+
+	var stale []string
+	for name, info := range s.tools {
+		if current, ok := wanted[name]; !ok || current.Tool != info.Tool {
+			stale = append(stale, name)
+			delete(s.tools, name)
+		}
+	}
+	if len(stale) > 0 {
+		s.mcpServer.RemoveTools(stale...)
+	}
+
+	for name, info := range wanted {
+		if _, exists := s.tools[name]; exists {
+			continue
+		}
+		s.mcpServer.AddTool(proxyTool(name, info.Tool), s.proxyToolHandler(name))
+		s.tools[name] = info
+	}
+}
+
+// syncPrompts registers newly discovered prompts and removes prompts whose server went away
+func (s *Server) syncPrompts() {
+	wanted, collisions := uniqueNames("Prompt", s.gw.ListPrompts(), func(info *gateway.PromptInfo) (string, string) {
+		return info.Name, info.Server
+	}, nil)
+	s.collisions = append(s.collisions, collisions...)
+
+	var stale []string
+	for name, info := range s.prompts {
+		if current, ok := wanted[name]; !ok || current.Prompt != info.Prompt {
+			stale = append(stale, name)
+			delete(s.prompts, name)
+		}
+	}
+	if len(stale) > 0 {
+		s.mcpServer.RemovePrompts(stale...)
+	}
+
+	for name, info := range wanted {
+		if _, exists := s.prompts[name]; exists {
+			continue
+		}
+		prompt := *info.Prompt
+		prompt.Name = name
+		s.mcpServer.AddPrompt(&prompt, s.proxyPromptHandler(name))
+		s.prompts[name] = info
+	}
+}
+
+// proxyPromptHandler returns a handler forwarding prompt requests to the server that owns the prompt
+func (s *Server) proxyPromptHandler(name string) mcpsdk.PromptHandler {
+	return func(ctx context.Context, req *mcpsdk.GetPromptRequest) (*mcpsdk.GetPromptResult, error) {
+		return s.gw.GetPrompt(ctx, name, req.Params.Arguments)
+	}
+}
+
+// syncResources registers newly discovered resources and templates and removes stale ones
+func (s *Server) syncResources() {
+	wanted := make(map[string]*gateway.ResourceInfo)
+	for _, info := range s.gw.ListResources() {
+		if _, err := url.Parse(info.URI); err != nil {
+			log.Printf("Skipping resource %s from server %s: %v", info.Resource.URI, info.Server, err)
+			continue
+		}
+		wanted[info.URI] = info
+	}
+
+	var stale []string
+	for uri, info := range s.resources {
+		if current, ok := wanted[uri]; !ok || current.Resource != info.Resource {
+			stale = append(stale, uri)
+			delete(s.resources, uri)
+		}
+	}
+	if len(stale) > 0 {
+		s.mcpServer.RemoveResources(stale...)
+	}
+
+	for uri, info := range wanted {
+		if _, exists := s.resources[uri]; exists {
+			continue
+		}
+		resource := *info.Resource
+		resource.URI = uri
+		s.mcpServer.AddResource(&resource, s.readResource)
+		s.resources[uri] = info
+	}
+
+	wantedTemplates := make(map[string]*gateway.ResourceTemplateInfo)
+	for _, info := range s.gw.ListResourceTemplates() {
+		wantedTemplates[info.URITemplate] = info
+	}
+
+	stale = nil
+	for uriTemplate, info := range s.templates {
+		if current, ok := wantedTemplates[uriTemplate]; !ok || current.Template != info.Template {
+			stale = append(stale, uriTemplate)
+			delete(s.templates, uriTemplate)
+		}
+	}
+	if len(stale) > 0 {
+		s.mcpServer.RemoveResourceTemplates(stale...)
+	}
+
+	for uriTemplate, info := range wantedTemplates {
+		if _, exists := s.templates[uriTemplate]; exists {
+			continue
+		}
+		template := *info.Template
+		template.URITemplate = uriTemplate
+		s.mcpServer.AddResourceTemplate(&template, s.readResource)
+		s.templates[uriTemplate] = info
+	}
+}
+
+// readResource forwards a resource read to the server that owns the resource
+func (s *Server) readResource(ctx context.Context, req *mcpsdk.ReadResourceRequest) (*mcpsdk.ReadResourceResult, error) {
+	return s.gw.ReadResource(ctx, req.Params.URI)
+}
+
+// resourceUpdated notifies subscribed clients that a resource changed
+func (s *Server) resourceUpdated(uri string) {
+	if err := s.mcpServer.ResourceUpdated(context.Background(), &mcpsdk.ResourceUpdatedNotificationParams{URI: uri}); err != nil {
+		log.Printf("Failed to forward update of resource %s: %v", uri, err)
+	}
+}
+
+// proxyTool copies a child server's tool definition under its exposed name
+func proxyTool(name string, tool *mcpsdk.Tool) *mcpsdk.Tool {
+	proxied := *tool
+	proxied.Name = name
+
+	// The SDK requires an object input schema; some servers omit it for argument-less tools
+	schema, ok := proxied.InputSchema.(map[string]interface{})
+	if !ok || schema["type"] != "object" {
+		proxied.InputSchema = map[string]interface{}{"type": "object"}
+	}
+	if schema, ok := proxied.OutputSchema.(map[string]interface{}); ok && schema["type"] != "object" {
+		proxied.OutputSchema = nil
+	}
+
+	return &proxied
+}
+
+// proxyToolHandler returns a handler forwarding calls to the server that owns the tool
+func (s *Server) proxyToolHandler(name string) mcpsdk.ToolHandler {
+	return func(ctx context.Context, req *mcpsdk.CallToolRequest) (*mcpsdk.CallToolResult, error) {
+		return s.gw.CallTool(ctx, name, req.Params.Arguments)
+	}
+}
+
 // ListServersArgs represents arguments for the list_servers tool
 type ListServersArgs struct{}
 
 // ListServers lists all installed servers
 func (s *Server) ListServers(ctx context.Context, req *mcpsdk.CallToolRequest, args ListServersArgs) (*mcpsdk.CallToolResult, any, error) {
-	fmt.Printf("DEBUG: ListServers tool called\n")
+	log.Printf("DEBUG: ListServers tool called")
 	servers := s.gw.ListServers()
-	fmt.Printf("DEBUG: Found %d servers\n", len(servers))
+	log.Printf("DEBUG: Found %d servers", len(servers))
 
 	if len(servers) == 0 {
 		return &mcpsdk.CallToolResult{
@@ -65,7 +385,16 @@ func (s *Server) ListServers(ctx context.Context, req *mcpsdk.CallToolRequest, a
 		result += fmt.Sprintf("- %s (%s): %s\n", server.Name, server.Type, server.Status)
 	}
 
-	fmt.Printf("DEBUG: Returning result: %s\n", result)
+	s.catalogMux.Lock()
+	if len(s.collisions) > 0 {
+		result += "\nName collisions (not registered):\n"
+		for _, collision := range s.collisions {
+			result += fmt.Sprintf("- %s %s: %s\n", strings.ToLower(collision.Kind), collision.Name, strings.Join(collision.Servers, ", "))
+		}
+	}
+	s.catalogMux.Unlock()
+
+	log.Printf("DEBUG: Returning result: %s", result)
 	return &mcpsdk.CallToolResult{
 		Content: []mcpsdk.Content{
 			&mcpsdk.TextContent{Text: result},
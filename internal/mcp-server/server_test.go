@@ -0,0 +1,45 @@
+package mcp_server
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestUniqueNamesReportsCollisions(t *testing.T) {
+	type entry struct{ name, server string }
+	entries := []entry{
+		{"github__search", "github"},
+		{"echo", "alpha"},
+		{"echo", "beta"},
+		{"list_servers", "gamma"},
+		{"fs__read", "fs"},
+	}
+
+	unique, collisions := uniqueNames("Tool", entries, func(e entry) (string, string) {
+		return e.name, e.server
+	}, map[string]bool{"list_servers": true})
+
+	var names []string
+	for name := range unique {
+		names = append(names, name)
+	}
+	if len(unique) != 2 || unique["github__search"].server != "github" || unique["fs__read"].server != "fs" {
+		t.Errorf("unique names = %v, want github__search and fs__read", names)
+	}
+
+	want := map[string][]string{
+		"echo":         {"alpha", "beta"},
+		"list_servers": {"gamma", "onemcp"},
+	}
+	if len(collisions) != len(want) {
+		t.Fatalf("got %d collisions, want %d", len(collisions), len(want))
+	}
+	for _, collision := range collisions {
+		if collision.Kind != "Tool" {
+			t.Errorf("collision kind = %q, want Tool", collision.Kind)
+		}
+		if !reflect.DeepEqual(collision.Servers, want[collision.Name]) {
+			t.Errorf("collision on %s between %v, want %v", collision.Name, collision.Servers, want[collision.Name])
+		}
+	}
+}
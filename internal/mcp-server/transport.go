@@ -0,0 +1,111 @@
+package mcp_server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// HTTP paths served by the gateway. Streamable HTTP lives on StreamablePath; the
+// legacy HTTP+SSE transport opens its event stream on SSEPath and receives client
+// messages on MessagesPath.
+const (
+	StreamablePath = "/mcp"
+	SSEPath        = "/sse"
+	MessagesPath   = "/messages"
+)
+
+// shutdownTimeout bounds how long HTTP clients get to finish when the gateway stops
+const shutdownTimeout = 5 * time.Second
+
+// Serve runs the MCP server over the transport selected in the gateway configuration.
+// It blocks until the context is cancelled or, for stdio, the client disconnects.
+func (s *Server) Serve(ctx context.Context, server *mcpsdk.Server) error {
+	switch s.config.Gateway.Transport {
+	case "", config.TransportStdio:
+		return server.Run(ctx, &mcpsdk.StdioTransport{})
+	case config.TransportHTTP, config.TransportSSE:
+		return s.serveHTTP(ctx, s.httpHandler(server))
+	default:
+		return fmt.Errorf("unsupported gateway transport: %s", s.config.Gateway.Transport)
+	}
+}
+
+// Address returns the HTTP address the gateway listens on
+func (s *Server) Address() string {
+	return fmt.Sprintf("%s:%d", s.config.Gateway.Host, s.config.Gateway.Port)
+}
+
+// Endpoint returns the URL clients of the configured HTTP transport connect to
+func (s *Server) Endpoint() string {
+	if s.config.Gateway.Transport == config.TransportSSE {
+		return "http://" + s.Address() + SSEPath
+	}
+	return "http://" + s.Address() + StreamablePath
+}
+
+// httpHandler builds the HTTP routes serving the MCP server. Both transports share
+// one listener and the same aggregated server, whichever one is configured.
+func (s *Server) httpHandler(server *mcpsdk.Server) http.Handler {
+	getServer := func(*http.Request) *mcpsdk.Server { return server }
+
+	// Every client gets its own session; the event store lets clients resume
+	// SSE streams after a dropped connection
+	streamable := mcpsdk.NewStreamableHTTPHandler(getServer, &mcpsdk.StreamableHTTPOptions{
+		EventStore: mcpsdk.NewMemoryEventStore(nil),
+	})
+
+	// Older clients speak the 2024-11-05 HTTP+SSE transport
+	sse := mcpsdk.NewSSEHandler(getServer, nil)
+
+	mux := http.NewServeMux()
+	mux.Handle(StreamablePath, streamable)
+	mux.Handle("GET "+SSEPath, sseStream(sse))
+	mux.Handle("POST "+MessagesPath, sse)
+	return mux
+}
+
+// sseStream opens SSE sessions whose announced message endpoint is MessagesPath.
+// The SDK derives the endpoint from the request URL, so the path is rewritten
+// before the request reaches the handler.
+func sseStream(sse *mcpsdk.SSEHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r = r.Clone(r.Context())
+		r.URL.Path = MessagesPath
+		r.URL.RawPath = ""
+		sse.ServeHTTP(w, r)
+	})
+}
+
+// serveHTTP listens on the configured address until the context is cancelled
+func (s *Server) serveHTTP(ctx context.Context, handler http.Handler) error {
+	httpServer := &http.Server{
+		Addr:    s.Address(),
+		Handler: handler,
+	}
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Printf("MCP gateway listening on http://%s", httpServer.Addr)
+		errCh <- httpServer.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return fmt.Errorf("MCP gateway HTTP server failed: %w", err)
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := httpServer.Shutdown(shutdownCtx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	return nil
+}
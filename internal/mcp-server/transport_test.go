@@ -0,0 +1,110 @@
+package mcp_server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mdarshad-ai/OneMCP/internal/config"
+	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+	"github.com/mdarshad-ai/OneMCP/internal/storage"
+	mcpsdk "github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// newHTTPGateway serves a gateway without servers over HTTP, as configured by transport
+func newHTTPGateway(t *testing.T, transport string) (*Server, *httptest.Server) {
+	t.Helper()
+	store, err := storage.NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := config.DefaultConfig()
+	cfg.Gateway.Transport = transport
+
+	s := NewServer(cfg, gateway.NewGateway(cfg, store))
+	ts := httptest.NewServer(s.httpHandler(s.CreateMCPServer()))
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+// connect opens a client session to the gateway and checks it serves the catalog
+func connect(t *testing.T, transport mcpsdk.Transport) *mcpsdk.ClientSession {
+	t.Helper()
+	client := mcpsdk.NewClient(&mcpsdk.Implementation{Name: "test", Version: "1.0.0"}, nil)
+	session, err := client.Connect(context.Background(), transport, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(func() { session.Close() })
+
+	result, err := session.CallTool(context.Background(), &mcpsdk.CallToolParams{Name: "list_servers"})
+	if err != nil || result.IsError {
+		t.Fatalf("list_servers = %v, %v; want the gateway's answer", result, err)
+	}
+	return session
+}
+
+func TestStreamableHTTPServesGateway(t *testing.T) {
+	s, ts := newHTTPGateway(t, config.TransportHTTP)
+	if want := "http://127.0.0.1:5234/mcp"; s.Endpoint() != want {
+		t.Errorf("Endpoint = %s; want %s", s.Endpoint(), want)
+	}
+
+	// Every client gets a session of its own
+	first := connect(t, &mcpsdk.StreamableClientTransport{Endpoint: ts.URL + StreamablePath})
+	second := connect(t, &mcpsdk.StreamableClientTransport{Endpoint: ts.URL + StreamablePath})
+	if first.ID() == "" || first.ID() == second.ID() {
+		t.Errorf("clients got sessions %q and %q; want distinct ones", first.ID(), second.ID())
+	}
+
+	resp, err := http.Get(ts.URL + "/unknown")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("GET /unknown = %d; want %d", resp.StatusCode, http.StatusNotFound)
+	}
+}
+
+func TestLegacySSEServesGateway(t *testing.T) {
+	s, ts := newHTTPGateway(t, config.TransportSSE)
+	if want := "http://127.0.0.1:5234/sse"; s.Endpoint() != want {
+		t.Errorf("Endpoint = %s; want %s", s.Endpoint(), want)
+	}
+
+	// The event stream announces the messages endpoint, where the client then posts
+	connect(t, &mcpsdk.SSEClientTransport{Endpoint: ts.URL + SSEPath})
+
+	// Streamable HTTP clients are served on the same listener
+	connect(t, &mcpsdk.StreamableClientTransport{Endpoint: ts.URL + StreamablePath})
+
+	for _, tt := range []struct{ method, path string }{
+		{http.MethodPost, SSEPath},
+		{http.MethodGet, MessagesPath},
+	} {
+		req, err := http.NewRequest(tt.method, ts.URL+tt.path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusMethodNotAllowed {
+			t.Errorf("%s %s = %d; want %d", tt.method, tt.path, resp.StatusCode, http.StatusMethodNotAllowed)
+		}
+	}
+
+	// Messages for a session that does not exist are refused
+	resp, err := http.Post(ts.URL+MessagesPath+"?sessionid=missing", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("POST %s for an unknown session = %d; want %d", MessagesPath, resp.StatusCode, http.StatusNotFound)
+	}
+}
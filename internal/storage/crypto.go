@@ -0,0 +1,537 @@
+package storage
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// Environment variables supplying the master key that encrypts credentials
+const (
+	EnvMasterKey  = "ONEMCP_MASTER_KEY" // base64 of a 32-byte key
+	EnvPassphrase = "ONEMCP_PASSPHRASE" // passphrase the key is derived from
+	EnvKeyFile    = "ONEMCP_KEY_FILE"   // key file to use instead of ~/.mcp/master.key
+)
+
+// Sources of the master key
+const (
+	KeySourceFile       = "file"
+	KeySourceEnv        = "env"
+	KeySourcePassphrase = "passphrase"
+)
+
+// ErrNoCredentials is returned for a server that has no stored credentials
+var ErrNoCredentials = errors.New("no credentials stored")
+
+// ErrWrongKey is returned when the master key cannot decrypt the stored credentials
+var ErrWrongKey = errors.New("the master key does not match the one the credentials were encrypted with")
+
+const (
+	masterKeySize = 32 // AES-256
+	keyringFile   = "keyring.json"
+	keyCheckValue = "onemcp"
+	cipherName    = "aes-256-gcm"
+)
+
+// keyringInfo records how the master key is obtained. It holds no secret, only a
+// known value sealed with the key, so that a wrong key is detected up front.
+type keyringInfo struct {
+	Version int        `json:"version"`
+	Source  string     `json:"source"`
+	KDF     *kdfParams `json:"kdf,omitempty"`
+	Check   *sealed    `json:"check"`
+}
+
+// kdfParams are the Argon2id parameters deriving the key from a passphrase
+type kdfParams struct {
+	Algorithm string `json:"algorithm"`
+	Salt      []byte `json:"salt"`
+	Time      uint32 `json:"time"`
+	Memory    uint32 `json:"memory"` // KiB
+	Threads   uint8  `json:"threads"`
+}
+
+// sealed is data encrypted with the master key, as stored on disk
+type sealed struct {
+	Version    int    `json:"version"`
+	Cipher     string `json:"cipher"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// PassphrasePrompt asks the user for a passphrase; label says which one
+type PassphrasePrompt func(label string) (string, error)
+
+// SetPassphrasePrompt lets the storage ask for the passphrase when it is not in
+// the environment. Without a prompt, a passphrase must come from ONEMCP_PASSPHRASE.
+func (fs *FileStorage) SetPassphrasePrompt(prompt PassphrasePrompt) {
+	fs.keyMux.Lock()
+	defer fs.keyMux.Unlock()
+	fs.prompt = prompt
+}
+
+// KeySource returns where the master key comes from, or "" before any credential is stored
+func (fs *FileStorage) KeySource() (string, error) {
+	info, err := fs.loadKeyring()
+	if err != nil || info == nil {
+		return "", err
+	}
+	return info.Source, nil
+}
+
+// masterKey returns the key credentials are encrypted with. On first use a keyring
+// is created: from ONEMCP_MASTER_KEY or ONEMCP_PASSPHRASE if one is set, otherwise
+// with a random key in the key file.
+func (fs *FileStorage) masterKey() ([]byte, error) {
+	fs.keyMux.Lock()
+	defer fs.keyMux.Unlock()
+
+	if fs.key != nil {
+		return fs.key, nil
+	}
+
+	info, err := fs.loadKeyring()
+	if err != nil {
+		return nil, err
+	}
+
+	var key []byte
+	if info == nil {
+		source, secret := KeySourceFile, ""
+		if os.Getenv(EnvMasterKey) != "" {
+			source = KeySourceEnv
+		} else if os.Getenv(EnvPassphrase) != "" {
+			source = KeySourcePassphrase
+		} else if secret, err = initKeyFile(fs.keyFilePath()); err != nil {
+			return nil, err
+		}
+
+		if info, key, err = fs.newKeyring(source, secret); err != nil {
+			return nil, err
+		}
+		if err := fs.saveKeyring(info, true); err != nil {
+			if !errors.Is(err, os.ErrExist) {
+				return nil, fmt.Errorf("failed to create keyring: %w", err)
+			}
+			// Another process created the keyring first; use theirs
+			if info, err = fs.loadKeyring(); err != nil {
+				return nil, err
+			}
+			key = nil
+		}
+	}
+
+	if key == nil {
+		if key, err = fs.resolveKey(info); err != nil {
+			return nil, err
+		}
+	}
+	if _, err := openSealed(key, info.Check, keyringFile); err != nil {
+		return nil, ErrWrongKey
+	}
+
+	fs.key = key
+	return key, nil
+}
+
+// forgetKey drops the cached master key so the next use loads it again. It reports
+// whether a key was cached.
+func (fs *FileStorage) forgetKey() bool {
+	fs.keyMux.Lock()
+	defer fs.keyMux.Unlock()
+	cached := fs.key != nil
+	fs.key = nil
+	return cached
+}
+
+// resolveKey obtains the master key described by the keyring
+func (fs *FileStorage) resolveKey(info *keyringInfo) ([]byte, error) {
+	switch info.Source {
+	case KeySourceEnv:
+		encoded := os.Getenv(EnvMasterKey)
+		if encoded == "" {
+			return nil, fmt.Errorf("credentials are encrypted with a key from the environment; set %s", EnvMasterKey)
+		}
+		return decodeKey(encoded)
+
+	case KeySourcePassphrase:
+		if info.KDF == nil {
+			return nil, fmt.Errorf("keyring has no key derivation parameters")
+		}
+		passphrase, err := fs.passphrase("Passphrase for OneMCP credentials", EnvPassphrase)
+		if err != nil {
+			return nil, err
+		}
+		return deriveKey(passphrase, info.KDF), nil
+
+	case KeySourceFile:
+		return readKeyFile(fs.keyFilePath())
+	}
+	return nil, fmt.Errorf("unsupported master key source: %s", info.Source)
+}
+
+// newKeyring creates a master key from source and the keyring describing it. The
+// secret is the passphrase or the base64 key; without one, a passphrase is taken
+// from the environment or asked for, and other keys are generated.
+func (fs *FileStorage) newKeyring(source, secret string) (*keyringInfo, []byte, error) {
+	info := &keyringInfo{Version: 1, Source: source}
+
+	var key []byte
+	var err error
+	switch source {
+	case KeySourceEnv, KeySourceFile:
+		if secret == "" && source == KeySourceEnv {
+			secret = os.Getenv(EnvMasterKey)
+		}
+		if secret == "" {
+			key, err = randomBytes(masterKeySize)
+		} else {
+			key, err = decodeKey(secret)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+
+	case KeySourcePassphrase:
+		if secret == "" {
+			if secret, err = fs.passphrase("Passphrase for OneMCP credentials", EnvPassphrase); err != nil {
+				return nil, nil, err
+			}
+		}
+		info.KDF = &kdfParams{Algorithm: "argon2id", Time: 3, Memory: 64 * 1024, Threads: 4}
+		if info.KDF.Salt, err = randomBytes(16); err != nil {
+			return nil, nil, err
+		}
+		key = deriveKey(secret, info.KDF)
+
+	default:
+		return nil, nil, fmt.Errorf("unsupported master key source: %s (use file, env or passphrase)", source)
+	}
+
+	if info.Check, err = seal(key, []byte(keyCheckValue), keyringFile); err != nil {
+		return nil, nil, err
+	}
+	return info, key, nil
+}
+
+// Rekey re-encrypts every stored credential under a new master key from source,
+// encrypting plain text credentials along the way. The secret is the new passphrase
+// or base64 key; for the env source a key is generated if none is given, and
+// returned so it can be set in ONEMCP_MASTER_KEY.
+func (fs *FileStorage) Rekey(source, secret string) (string, error) {
+	paths, err := filepath.Glob(filepath.Join(fs.GetCredentialsDir(), "*.key"))
+	if err != nil {
+		return "", fmt.Errorf("failed to list credentials: %w", err)
+	}
+
+	// Decrypt everything before anything is rewritten
+	all := make(map[string]*Credential)
+	for _, path := range paths {
+		name := strings.TrimSuffix(filepath.Base(path), ".key")
+		creds, _, err := fs.readCredentials(name)
+		if err != nil {
+			return "", err
+		}
+		all[name] = creds
+	}
+
+	var generated string
+	if source == KeySourceEnv && secret == "" {
+		key, err := randomBytes(masterKeySize)
+		if err != nil {
+			return "", err
+		}
+		secret = base64.StdEncoding.EncodeToString(key)
+		generated = secret
+	}
+
+	info, key, err := fs.newKeyring(source, secret)
+	if err != nil {
+		return "", err
+	}
+
+	// Stage the new files next to the old ones, then swap them in
+	staged := make(map[string]string)
+	defer func() {
+		for tmp := range staged {
+			os.Remove(tmp)
+		}
+	}()
+
+	if source == KeySourceFile {
+		tmp := fs.keyFilePath() + ".new"
+		data := []byte(base64.StdEncoding.EncodeToString(key) + "\n")
+		if err := writeFileAtomic(tmp, data, 0600); err != nil {
+			return "", fmt.Errorf("failed to write master key file: %w", err)
+		}
+		staged[tmp] = fs.keyFilePath()
+	}
+	for name, creds := range all {
+		tmp := fs.GetCredentialsPath(name) + ".new"
+		if err := writeCredentials(tmp, name, creds, key); err != nil {
+			return "", err
+		}
+		staged[tmp] = fs.GetCredentialsPath(name)
+	}
+
+	fs.keyMux.Lock()
+	defer fs.keyMux.Unlock()
+
+	// The old files are kept until the keyring is written, so that a failure can
+	// put everything back as it was
+	type swap struct{ path, backup string }
+	var swapped []swap
+	rollback := func() {
+		for i := len(swapped) - 1; i >= 0; i-- {
+			if swapped[i].backup == "" {
+				os.Remove(swapped[i].path)
+			} else {
+				os.Rename(swapped[i].backup, swapped[i].path)
+			}
+		}
+	}
+
+	for tmp, path := range staged {
+		s := swap{path: path}
+		if _, err := os.Stat(path); err == nil {
+			s.backup = path + ".old"
+			if err := os.Rename(path, s.backup); err != nil {
+				rollback()
+				return "", fmt.Errorf("failed to replace %s: %w", path, err)
+			}
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			if s.backup != "" {
+				os.Rename(s.backup, path)
+			}
+			rollback()
+			return "", fmt.Errorf("failed to replace %s: %w", path, err)
+		}
+		swapped = append(swapped, s)
+		delete(staged, tmp)
+	}
+	if err := fs.saveKeyring(info, false); err != nil {
+		rollback()
+		return "", fmt.Errorf("failed to write keyring: %w", err)
+	}
+	for _, s := range swapped {
+		if s.backup != "" {
+			os.Remove(s.backup)
+		}
+	}
+
+	fs.key = key
+	return generated, nil
+}
+
+// passphrase reads a passphrase from the environment variable, or asks for it
+func (fs *FileStorage) passphrase(label, env string) (string, error) {
+	if passphrase := os.Getenv(env); passphrase != "" {
+		return passphrase, nil
+	}
+	if fs.prompt == nil {
+		return "", fmt.Errorf("credentials are encrypted with a passphrase; set %s", env)
+	}
+	passphrase, err := fs.prompt(label)
+	if err != nil {
+		return "", err
+	}
+	if passphrase == "" {
+		return "", fmt.Errorf("the passphrase must not be empty")
+	}
+	return passphrase, nil
+}
+
+// loadKeyring reads the keyring, returning nil if there is none yet
+func (fs *FileStorage) loadKeyring() (*keyringInfo, error) {
+	data, err := os.ReadFile(filepath.Join(fs.GetCredentialsDir(), keyringFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read keyring: %w", err)
+	}
+
+	var info keyringInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, fmt.Errorf("failed to parse keyring: %w", err)
+	}
+	if info.Check == nil {
+		return nil, fmt.Errorf("keyring has no check value")
+	}
+	return &info, nil
+}
+
+// saveKeyring writes the keyring. With exclusive set it fails with os.ErrExist
+// if a keyring already exists.
+func (fs *FileStorage) saveKeyring(info *keyringInfo, exclusive bool) error {
+	data, err := json.MarshalIndent(info, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal keyring: %w", err)
+	}
+
+	path := filepath.Join(fs.GetCredentialsDir(), keyringFile)
+	if exclusive {
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if err != nil {
+			return err
+		}
+		if _, err := file.Write(data); err != nil {
+			file.Close()
+			return fmt.Errorf("failed to write keyring: %w", err)
+		}
+		return file.Close()
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+// keyFilePath returns the path of the master key file
+func (fs *FileStorage) keyFilePath() string {
+	if path := os.Getenv(EnvKeyFile); path != "" {
+		return path
+	}
+	return filepath.Join(fs.baseDir, "master.key")
+}
+
+// readKeyFile reads a master key file, refusing one that others may read
+func readKeyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	if runtime.GOOS != "windows" && info.Mode().Perm()&0077 != 0 {
+		return nil, fmt.Errorf("master key file %s is accessible by other users; run 'chmod 600 %s'", path, path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read master key file: %w", err)
+	}
+	return decodeKey(string(data))
+}
+
+// initKeyFile returns the base64 key in the key file, creating the file with a
+// random key and 0600 permissions if there is none
+func initKeyFile(path string) (string, error) {
+	key, err := randomBytes(masterKeySize)
+	if err != nil {
+		return "", err
+	}
+	encoded := base64.StdEncoding.EncodeToString(key)
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if errors.Is(err, os.ErrExist) {
+		if key, err = readKeyFile(path); err != nil {
+			return "", err
+		}
+		return base64.StdEncoding.EncodeToString(key), nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create master key file: %w", err)
+	}
+	if _, err := file.WriteString(encoded + "\n"); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write master key file: %w", err)
+	}
+	return encoded, file.Close()
+}
+
+// randomBytes returns n random bytes
+func randomBytes(n int) ([]byte, error) {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		return nil, fmt.Errorf("failed to generate random bytes: %w", err)
+	}
+	return data, nil
+}
+
+// decodeKey decodes a base64 master key
+func decodeKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil || len(key) != masterKeySize {
+		return nil, fmt.Errorf("a master key must be %d bytes, base64 encoded", masterKeySize)
+	}
+	return key, nil
+}
+
+// deriveKey derives the master key from a passphrase
+func deriveKey(passphrase string, params *kdfParams) []byte {
+	return argon2.IDKey([]byte(passphrase), params.Salt, params.Time, params.Memory, params.Threads, masterKeySize)
+}
+
+// seal encrypts data with AES-256-GCM. The label is authenticated along with it,
+// so sealed data cannot be moved to another file.
+func seal(key, data []byte, label string) (*sealed, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce, err := randomBytes(aead.NonceSize())
+	if err != nil {
+		return nil, err
+	}
+	return &sealed{
+		Version:    1,
+		Cipher:     cipherName,
+		Nonce:      nonce,
+		Ciphertext: aead.Seal(nil, nonce, data, []byte(label)),
+	}, nil
+}
+
+// openSealed decrypts data sealed with the same key and label
+func openSealed(key []byte, box *sealed, label string) ([]byte, error) {
+	if box.Cipher != cipherName {
+		return nil, fmt.Errorf("unsupported cipher: %s", box.Cipher)
+	}
+
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(box.Nonce) != aead.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce")
+	}
+	return aead.Open(nil, box.Nonce, box.Ciphertext, []byte(label))
+}
+
+// newAEAD returns the AES-256-GCM cipher for a master key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// writeFileAtomic replaces a file through a temporary file, so readers never see it half written
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
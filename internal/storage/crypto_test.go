@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStorage returns a storage in a temporary directory, with no master key
+// or passphrase coming from the environment
+func newTestStorage(t *testing.T) *FileStorage {
+	t.Helper()
+	t.Setenv(EnvMasterKey, "")
+	t.Setenv(EnvPassphrase, "")
+	t.Setenv(EnvKeyFile, "")
+
+	fs, err := NewFileStorage(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fs
+}
+
+// reopen returns a fresh storage on the same directory, without a cached key
+func reopen(t *testing.T, fs *FileStorage) *FileStorage {
+	t.Helper()
+	fresh, err := NewFileStorage(fs.GetBaseDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fresh
+}
+
+// testKey returns a base64 master key made of one repeated byte
+func testKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, masterKeySize))
+}
+
+// wantCredential checks that the server's credential key has the value
+func wantCredential(t *testing.T, fs *FileStorage, server, key, value string) {
+	t.Helper()
+	creds, err := fs.LoadCredentials(server)
+	if err != nil {
+		t.Fatalf("LoadCredentials(%s): %v", server, err)
+	}
+	if creds.Data[key] != value {
+		t.Errorf("credential %s of %s = %q, want %q", key, server, creds.Data[key], value)
+	}
+}
+
+func TestSealRoundTrip(t *testing.T) {
+	key, _ := decodeKey(testKey(1))
+	box, err := seal(key, []byte("secret"), "github")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(box.Ciphertext, []byte("secret")) {
+		t.Error("the ciphertext contains the plain text")
+	}
+
+	data, err := openSealed(key, box, "github")
+	if err != nil || string(data) != "secret" {
+		t.Fatalf("openSealed = %q, %v; want secret", data, err)
+	}
+
+	other, _ := decodeKey(testKey(2))
+	if _, err := openSealed(other, box, "github"); err == nil {
+		t.Error("data opened with another key")
+	}
+	if _, err := openSealed(key, box, "slack"); err == nil {
+		t.Error("data opened under another label")
+	}
+}
+
+func TestCredentialsWrongKey(t *testing.T) {
+	fs := newTestStorage(t)
+	t.Setenv(EnvMasterKey, testKey(1))
+	if err := fs.SaveCredentials("github", &Credential{Data: map[string]string{"TOKEN": "ghp_x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if source, _ := fs.KeySource(); source != KeySourceEnv {
+		t.Errorf("key source = %q, want %q", source, KeySourceEnv)
+	}
+
+	// The credentials are not readable without the key
+	data, err := os.ReadFile(fs.GetCredentialsPath("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("ghp_x")) {
+		t.Error("the credentials file contains the secret in plain text")
+	}
+
+	t.Setenv(EnvMasterKey, testKey(2))
+	if _, err := reopen(t, fs).LoadCredentials("github"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadCredentials with another key: %v, want ErrWrongKey", err)
+	}
+
+	t.Setenv(EnvMasterKey, testKey(1))
+	wantCredential(t, reopen(t, fs), "github", "TOKEN", "ghp_x")
+}
+
+func TestRekeyFileToPassphrase(t *testing.T) {
+	fs := newTestStorage(t)
+	if err := fs.SaveCredentials("github", &Credential{Data: map[string]string{"TOKEN": "ghp_x"}}); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(fs.keyFilePath())
+	if err != nil {
+		t.Fatalf("no key file was created: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("key file permissions = %o, want 600", info.Mode().Perm())
+	}
+
+	if _, err := fs.Rekey(KeySourcePassphrase, "correct horse"); err != nil {
+		t.Fatalf("Rekey: %v", err)
+	}
+	if source, _ := fs.KeySource(); source != KeySourcePassphrase {
+		t.Errorf("key source = %q, want %q", source, KeySourcePassphrase)
+	}
+	wantCredential(t, fs, "github", "TOKEN", "ghp_x")
+
+	// Later runs need the passphrase, and only the right one works
+	if _, err := reopen(t, fs).LoadCredentials("github"); err == nil {
+		t.Error("credentials loaded without the passphrase")
+	}
+	t.Setenv(EnvPassphrase, "wrong")
+	if _, err := reopen(t, fs).LoadCredentials("github"); !errors.Is(err, ErrWrongKey) {
+		t.Errorf("LoadCredentials with a wrong passphrase: %v, want ErrWrongKey", err)
+	}
+	t.Setenv(EnvPassphrase, "correct horse")
+	wantCredential(t, reopen(t, fs), "github", "TOKEN", "ghp_x")
+
+	leftovers, _ := filepath.Glob(filepath.Join(fs.GetCredentialsDir(), "*.key.*"))
+	if len(leftovers) > 0 {
+		t.Errorf("rekey left %v behind", leftovers)
+	}
+}
+
+func TestRekeyRollsBack(t *testing.T) {
+	fs := newTestStorage(t)
+	for _, server := range []string{"github", "slack"} {
+		if err := fs.SaveCredentials(server, &Credential{Data: map[string]string{"TOKEN": server}}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyring, err := os.ReadFile(filepath.Join(fs.GetCredentialsDir(), keyringFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A file that cannot be staged stops the rekey before anything is replaced
+	blocked := fs.GetCredentialsPath("slack") + ".new"
+	if err := os.Mkdir(blocked, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(blocked, "x"), nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Rekey(KeySourcePassphrase, "correct horse"); err == nil {
+		t.Fatal("Rekey succeeded although a file could not be staged")
+	}
+	os.RemoveAll(blocked)
+	if _, err := os.Stat(fs.GetCredentialsPath("github") + ".new"); !os.IsNotExist(err) {
+		t.Error("the staged files were not removed")
+	}
+
+	// A keyring that cannot be written puts the swapped files back
+	keyringPath := filepath.Join(fs.GetCredentialsDir(), keyringFile)
+	if err := os.Rename(keyringPath, keyringPath+".saved"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Join(keyringPath, "blocked"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fs.Rekey(KeySourcePassphrase, "correct horse"); err == nil {
+		t.Fatal("Rekey succeeded although the keyring could not be written")
+	}
+	os.RemoveAll(keyringPath)
+	if err := os.Rename(keyringPath+".saved", keyringPath); err != nil {
+		t.Fatal(err)
+	}
+
+	current, err := os.ReadFile(keyringPath)
+	if err != nil || !bytes.Equal(current, keyring) {
+		t.Error("the keyring changed")
+	}
+	fresh := reopen(t, fs)
+	for _, server := range []string{"github", "slack"} {
+		wantCredential(t, fresh, server, "TOKEN", server)
+	}
+	leftovers, _ := filepath.Glob(filepath.Join(fs.GetCredentialsDir(), "*.key.*"))
+	if len(leftovers) > 0 {
+		t.Errorf("the failed rekeys left %v behind", leftovers)
+	}
+}
+
+func TestPlaintextCredentialsMigrated(t *testing.T) {
+	fs := newTestStorage(t)
+	plain, _ := json.Marshal(&Credential{Data: map[string]string{"TOKEN": "ghp_x"}})
+	if err := os.WriteFile(fs.GetCredentialsPath("github"), plain, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	wantCredential(t, fs, "github", "TOKEN", "ghp_x")
+
+	data, err := os.ReadFile(fs.GetCredentialsPath("github"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var box sealed
+	if err := json.Unmarshal(data, &box); err != nil || box.Cipher != cipherName {
+		t.Fatalf("credentials were not encrypted on load: %s", data)
+	}
+	if bytes.Contains(data, []byte("ghp_x")) {
+		t.Error("the migrated file still contains the secret")
+	}
+	wantCredential(t, reopen(t, fs), "github", "TOKEN", "ghp_x")
+}
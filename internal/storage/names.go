@@ -0,0 +1,238 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// MaxServerNameLength is the longest server name allowed
+const MaxServerNameLength = 64
+
+// ErrInvalidName matches every InvalidNameError
+var ErrInvalidName = errors.New("invalid server name")
+
+// InvalidNameError reports a server name that cannot be used, since server names
+// become file names in the storage directory and prefixes of tool names
+type InvalidNameError struct {
+	Name   string
+	Reason string
+}
+
+func (e *InvalidNameError) Error() string {
+	return fmt.Sprintf("invalid server name %q: %s", e.Name, e.Reason)
+}
+
+// Is makes errors.Is(err, ErrInvalidName) match
+func (e *InvalidNameError) Is(target error) bool {
+	return target == ErrInvalidName
+}
+
+// windowsDeviceNames cannot be used as file names on Windows, whatever the extension
+var windowsDeviceNames = map[string]bool{
+	"con": true, "prn": true, "aux": true, "nul": true,
+	"com1": true, "com2": true, "com3": true, "com4": true, "com5": true, "com6": true, "com7": true, "com8": true, "com9": true,
+	"lpt1": true, "lpt2": true, "lpt3": true, "lpt4": true, "lpt5": true, "lpt6": true, "lpt7": true, "lpt8": true, "lpt9": true,
+}
+
+// NormalizeServerName returns the canonical form of a server name given by a user,
+// trimmed and lowercased, or an InvalidNameError if it is not a valid name
+func NormalizeServerName(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if err := ValidateServerName(normalized); err != nil {
+		return "", &InvalidNameError{Name: name, Reason: err.(*InvalidNameError).Reason}
+	}
+	return normalized, nil
+}
+
+// ValidateServerName checks that a name is a canonical server name: 1 to 64
+// lowercase letters, digits, '-', '_' and '.', starting with a letter or digit
+func ValidateServerName(name string) error {
+	invalid := func(reason string) error {
+		return &InvalidNameError{Name: name, Reason: reason}
+	}
+
+	if name == "" {
+		return invalid("it is empty")
+	}
+	if len(name) > MaxServerNameLength {
+		return invalid(fmt.Sprintf("it is longer than %d characters", MaxServerNameLength))
+	}
+	for i, r := range name {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9':
+		case r == '-' || r == '_' || r == '.':
+			if i == 0 {
+				return invalid("it must start with a letter or digit")
+			}
+		default:
+			return invalid(fmt.Sprintf("it contains %q; use lowercase letters, digits, '-', '_' and '.'", r))
+		}
+	}
+	if base, _, _ := strings.Cut(name, "."); windowsDeviceNames[base] {
+		return invalid("it is reserved on Windows")
+	}
+	return nil
+}
+
+// SanitizeServerName turns an arbitrary name into a valid one, replacing runs of
+// invalid characters with '-'. It returns "" if nothing usable is left.
+func SanitizeServerName(name string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(strings.TrimSpace(name)) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') || r == '_' || r == '.' || r == '-' {
+			b.WriteRune(r)
+			dash = r == '-'
+		} else if !dash {
+			b.WriteRune('-')
+			dash = true
+		}
+	}
+
+	sanitized := strings.Trim(b.String(), "-_.")
+	if len(sanitized) > MaxServerNameLength {
+		sanitized = strings.TrimRight(sanitized[:MaxServerNameLength], "-_.")
+	}
+	if ValidateServerName(sanitized) != nil {
+		return ""
+	}
+	return sanitized
+}
+
+// checkConfigName checks that a configuration read from path has a canonical name
+// matching its file name, so that everything stored under the name stays together
+func checkConfigName(config *ServerConfig, path string) error {
+	if err := ValidateServerName(config.Name); err != nil {
+		return err
+	}
+	if stem := strings.TrimSuffix(filepath.Base(path), ".json"); config.Name != stem {
+		return &InvalidNameError{Name: config.Name, Reason: fmt.Sprintf("it does not match the file name %s", filepath.Base(path))}
+	}
+	return nil
+}
+
+// NameMigration records a server renamed by MigrateServerNames, or one it had to leave
+type NameMigration struct {
+	File string // configuration file, relative to the servers directory
+	From string
+	To   string // empty if the server could not be renamed
+	Err  error
+}
+
+// MigrateServerNames renames servers whose names are not canonical, which earlier
+// versions accepted, along with their credentials and logs. Configurations that
+// cannot be renamed are left alone; ListServerConfigs skips them.
+func (fs *FileStorage) MigrateServerNames() ([]NameMigration, error) {
+	matches, err := filepath.Glob(filepath.Join(fs.GetServersDir(), "*.json"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list server configs: %w", err)
+	}
+
+	var migrations []NameMigration
+	for _, match := range matches {
+		data, err := os.ReadFile(match)
+		if err != nil {
+			continue
+		}
+		var config ServerConfig
+		if err := json.Unmarshal(data, &config); err != nil {
+			continue
+		}
+
+		if checkConfigName(&config, match) == nil {
+			continue
+		}
+
+		file := filepath.Base(match)
+		stem := strings.TrimSuffix(file, ".json")
+
+		migration := NameMigration{File: file, From: config.Name}
+		to := SanitizeServerName(config.Name)
+		if to == "" {
+			to = SanitizeServerName(stem)
+		}
+		switch {
+		case to == "":
+			migration.Err = fmt.Errorf("no valid name can be derived from it")
+		case to != stem && otherFile(filepath.Join(fs.GetServersDir(), to+".json"), match):
+			migration.Err = fmt.Errorf("a server named %s already exists", to)
+		default:
+			migration.Err = fs.renameServer(match, &config, to)
+			if migration.Err == nil {
+				migration.To = to
+			}
+		}
+		migrations = append(migrations, migration)
+	}
+	return migrations, nil
+}
+
+// renameServer moves a server's configuration from path to the name to, and its
+// credentials and log from where its old name put them, if that was inside the
+// storage directory
+func (fs *FileStorage) renameServer(path string, config *ServerConfig, to string) error {
+	from := config.Name
+	contained := func(dir, file string) bool {
+		return from != "" && filepath.Dir(filepath.Join(dir, file)) == dir
+	}
+
+	if contained(fs.GetCredentialsDir(), from+".key") {
+		// Credentials are bound to the server name, so they are encrypted again
+		creds, _, err := fs.readCredentials(from)
+		if err == nil {
+			if err := fs.SaveCredentials(to, creds); err != nil {
+				return err
+			}
+		} else if !errors.Is(err, ErrNoCredentials) {
+			return err
+		}
+	}
+
+	config.Name = to
+	if err := fs.SaveServerConfig(config); err != nil {
+		return err
+	}
+	if err := removeReplaced(path, filepath.Join(fs.GetServersDir(), to+".json")); err != nil {
+		return fmt.Errorf("failed to remove old server config: %w", err)
+	}
+
+	if contained(fs.GetCredentialsDir(), from+".key") {
+		if err := removeReplaced(fs.GetCredentialsPath(from), fs.GetCredentialsPath(to)); err != nil {
+			log.Printf("Failed to remove the old credentials of server %s: %v", from, err)
+		}
+	}
+	if contained(fs.GetLogsDir(), from+".log") && from != to {
+		if err := os.Rename(fs.GetLogPath(from), fs.GetLogPath(to)); err != nil && !os.IsNotExist(err) {
+			log.Printf("Failed to move the log of server %s: %v", from, err)
+		}
+	}
+	if contained(filepath.Dir(fs.GetCatalogPath(to)), from+".json") {
+		// The catalog is rebuilt under the new name
+		removeReplaced(fs.GetCatalogPath(from), fs.GetCatalogPath(to))
+	}
+	return nil
+}
+
+// otherFile reports whether a file exists at path that is not the file at self.
+// On case-insensitive filesystems, names differing in case are the same file.
+func otherFile(path, self string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	selfInfo, err := os.Stat(self)
+	return err != nil || !os.SameFile(info, selfInfo)
+}
+
+// removeReplaced removes the file at old unless it is the file at replacement
+func removeReplaced(old, replacement string) error {
+	if !otherFile(old, replacement) {
+		return nil
+	}
+	return os.Remove(old)
+}
@@ -0,0 +1,208 @@
+package storage
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidateServerName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"github", true},
+		{"brave-search", true},
+		{"my_server.v2", true},
+		{"1password", true},
+		{"console", true},
+		{strings.Repeat("a", 64), true},
+		{"", false},
+		{strings.Repeat("a", 65), false},
+		{"GitHub", false},
+		{"../x", false},
+		{"a/b", false},
+		{`a\b`, false},
+		{"..", false},
+		{".", false},
+		{".hidden", false},
+		{"-flag", false},
+		{"_private", false},
+		{"a b", false},
+		{"naïve", false},
+		{"con", false},
+		{"nul.json", false},
+		{"com1", false},
+		{"lpt9.txt", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateServerName(tt.name)
+		if tt.valid && err != nil {
+			t.Errorf("ValidateServerName(%q) = %v, want valid", tt.name, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidName) {
+			t.Errorf("ValidateServerName(%q) = %v, want ErrInvalidName", tt.name, err)
+		}
+	}
+}
+
+func TestNormalizeServerName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // empty if invalid
+	}{
+		{"github", "github"},
+		{" GitHub ", "github"},
+		{"Brave-Search", "brave-search"},
+		{strings.Repeat("A", 64), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 65), ""},
+		{"../x", ""},
+		{"A/B", ""},
+		{"..", ""},
+		{".Hidden", ""},
+		{"-x", ""},
+		{"CON", ""},
+		{"Aux.log", ""},
+		{"  ", ""},
+	}
+
+	for _, tt := range tests {
+		got, err := NormalizeServerName(tt.name)
+		if tt.want == "" {
+			var invalid *InvalidNameError
+			if !errors.As(err, &invalid) || invalid.Name != tt.name {
+				t.Errorf("NormalizeServerName(%q) = %q, %v; want an InvalidNameError for the given name", tt.name, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("NormalizeServerName(%q) = %q, %v; want %q", tt.name, got, err, tt.want)
+		}
+	}
+}
+
+func TestSanitizeServerName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string // empty if nothing usable is left
+	}{
+		{"github", "github"},
+		{"GitHub", "github"},
+		{"../evil", "evil"},
+		{"a/b", "a-b"},
+		{"My Server!", "my-server"},
+		{"--x--", "x"},
+		{".hidden", "hidden"},
+		{"..", ""},
+		{"/", ""},
+		{"con", ""},
+		{strings.Repeat("a", 65), strings.Repeat("a", 64)},
+		{strings.Repeat("a", 63) + "/b", strings.Repeat("a", 63)},
+	}
+
+	for _, tt := range tests {
+		got := SanitizeServerName(tt.name)
+		if got != tt.want {
+			t.Errorf("SanitizeServerName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+		if got != "" && ValidateServerName(got) != nil {
+			t.Errorf("SanitizeServerName(%q) = %q, which is not valid", tt.name, got)
+		}
+	}
+}
+
+func TestMigrateServerNames(t *testing.T) {
+	t.Setenv(EnvMasterKey, "")
+	t.Setenv(EnvPassphrase, "")
+	t.Setenv(EnvKeyFile, "")
+
+	root := t.TempDir()
+	fs, err := NewFileStorage(filepath.Join(root, "store"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writeConfig := func(file, name string) {
+		t.Helper()
+		data, _ := json.Marshal(&ServerConfig{Name: name, Type: ServerTypeCustom, Path: "/bin/true"})
+		if err := os.WriteFile(filepath.Join(fs.GetServersDir(), file), data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Where the old names would put credentials and logs, outside their directories
+	outside := map[string]string{
+		filepath.Join(fs.GetBaseDir(), "evil.key"): "not credentials",
+		filepath.Join(fs.GetBaseDir(), "evil.log"): "not a log",
+		filepath.Join(root, "deeper.key"):          "outside the storage directory",
+	}
+	for path, content := range outside {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	writeConfig("evil.json", "../evil")
+	writeConfig("deeper.json", "../../deeper")
+	writeConfig("GitHub.json", "GitHub")
+	writeConfig("dots.json", "..")
+	writeConfig("slack.json", "slack")
+	if err := fs.SaveCredentials("GitHub", &Credential{Data: map[string]string{"TOKEN": "ghp_x"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fs.GetLogPath("GitHub"), []byte("old log\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	migrations, err := fs.MigrateServerNames()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	renamed := make(map[string]string)
+	for _, m := range migrations {
+		if m.Err != nil {
+			renamed[m.From] = "error"
+		} else {
+			renamed[m.From] = m.To
+		}
+	}
+	want := map[string]string{"../evil": "evil", "../../deeper": "deeper", "GitHub": "github", "..": "dots"}
+	for from, to := range want {
+		if renamed[from] != to {
+			t.Errorf("server %q migrated to %q, want %q", from, renamed[from], to)
+		}
+	}
+	if _, ok := renamed["slack"]; ok {
+		t.Error("a valid server was migrated")
+	}
+
+	for _, name := range []string{"evil", "deeper", "github", "dots", "slack"} {
+		config, err := fs.LoadServerConfig(name)
+		if err != nil || config.Name != name {
+			t.Errorf("LoadServerConfig(%s) = %v, %v", name, config, err)
+		}
+	}
+	if creds, err := fs.LoadCredentials("github"); err != nil || creds.Data["TOKEN"] != "ghp_x" {
+		t.Errorf("the credentials of GitHub were not moved: %v, %v", creds, err)
+	}
+	if data, err := os.ReadFile(fs.GetLogPath("github")); err != nil || string(data) != "old log\n" {
+		t.Errorf("the log of GitHub was not moved: %q, %v", data, err)
+	}
+
+	// Nothing the old names pointed at outside their directories was touched
+	for path, content := range outside {
+		if data, err := os.ReadFile(path); err != nil || string(data) != content {
+			t.Errorf("%s was changed: %q, %v", path, data, err)
+		}
+	}
+
+	configs, err := fs.ListServerConfigs()
+	if err != nil || len(configs) != 5 {
+		t.Errorf("ListServerConfigs returned %d servers, %v; want 5", len(configs), err)
+	}
+}
@@ -0,0 +1,242 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schemes of the built-in credential references
+const (
+	SecretSchemeStore   = "store"
+	SecretSchemeEnv     = "env"
+	SecretSchemeFile    = "file"
+	SecretSchemeCommand = "cmd"
+)
+
+// DefaultCommandTTL is how long the output of a secret command is reused
+const DefaultCommandTTL = 5 * time.Minute
+
+// commandTimeout bounds a secret command, which may wait for a password manager
+const commandTimeout = 30 * time.Second
+
+// SecretProvider resolves credential references of one scheme, such as the
+// "pass show github/token" of "cmd:pass show github/token", to the secret they point to
+type SecretProvider interface {
+	Resolve(ref string) (string, error)
+}
+
+// StoreProvider reads secrets from the encrypted credential store, where literal
+// values set with set-key are kept. A reference names the server and key, so servers
+// can share a secret stored once: "store:github/GITHUB_TOKEN".
+type StoreProvider struct {
+	storage *FileStorage
+}
+
+// Resolve returns the value stored under the key of the server
+func (p StoreProvider) Resolve(ref string) (string, error) {
+	server, key, ok := strings.Cut(ref, "/")
+	if !ok || server == "" || key == "" {
+		return "", fmt.Errorf("invalid store reference %q: use server/KEY", ref)
+	}
+
+	creds, err := p.storage.LoadStoredCredentials(server)
+	if err != nil {
+		return "", err
+	}
+	if value, ok := creds.Data[key]; ok {
+		return value, nil
+	}
+	if _, ok := creds.Refs[key]; ok {
+		return "", fmt.Errorf("credential %s of %s is itself a reference", key, server)
+	}
+	return "", fmt.Errorf("credential %s of %s is not set", key, server)
+}
+
+// EnvProvider reads secrets from environment variables of the gateway: "env:GITHUB_TOKEN"
+type EnvProvider struct{}
+
+// Resolve returns the value of the environment variable
+func (EnvProvider) Resolve(ref string) (string, error) {
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", ref)
+	}
+	return value, nil
+}
+
+// FileProvider reads secrets from files, such as Docker or Kubernetes secrets:
+// "file:/run/secrets/github_token"
+type FileProvider struct{}
+
+// Resolve returns the contents of the file without the trailing newline
+func (FileProvider) Resolve(ref string) (string, error) {
+	if !filepath.IsAbs(ref) {
+		return "", fmt.Errorf("secret file %s must be an absolute path", ref)
+	}
+	data, err := os.ReadFile(ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to read secret file: %w", err)
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// CommandProvider runs a shell command and uses the first line of its output, the
+// way pass stores a password: "cmd:pass show github/token". Outputs are reused for
+// TTL, so password managers are not asked on every server start.
+type CommandProvider struct {
+	TTL time.Duration
+
+	cache   map[string]cachedSecret
+	running map[string]*secretCommand
+	mu      sync.Mutex
+}
+
+// secretCommand is a secret command in progress, whose result is shared by every
+// Resolve of the same reference made meanwhile
+type secretCommand struct {
+	done  chan struct{}
+	value string
+	err   error
+}
+
+// cachedSecret is the output of a secret command and when it stops being reused
+type cachedSecret struct {
+	value   string
+	expires time.Time
+}
+
+// NewCommandProvider creates a command provider reusing outputs for ttl; 0 disables the cache
+func NewCommandProvider(ttl time.Duration) *CommandProvider {
+	return &CommandProvider{TTL: ttl, cache: make(map[string]cachedSecret), running: make(map[string]*secretCommand)}
+}
+
+// Resolve runs the command, or returns its cached output. Commands of different
+// references run in parallel; the same reference runs once at a time.
+func (p *CommandProvider) Resolve(ref string) (string, error) {
+	p.mu.Lock()
+	if cached, ok := p.cache[ref]; ok && time.Now().Before(cached.expires) {
+		p.mu.Unlock()
+		return cached.value, nil
+	}
+	if running, ok := p.running[ref]; ok {
+		p.mu.Unlock()
+		<-running.done
+		return running.value, running.err
+	}
+	running := &secretCommand{done: make(chan struct{})}
+	p.running[ref] = running
+	p.mu.Unlock()
+
+	running.value, running.err = runSecretCommand(ref)
+
+	p.mu.Lock()
+	delete(p.running, ref)
+	if running.err == nil && p.TTL > 0 {
+		p.cache[ref] = cachedSecret{value: running.value, expires: time.Now().Add(p.TTL)}
+	}
+	p.mu.Unlock()
+	close(running.done)
+
+	return running.value, running.err
+}
+
+// runSecretCommand runs a secret command through the shell and returns the first
+// line of its output
+func runSecretCommand(ref string) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), commandTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", ref)
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", ref)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("secret command failed: %w: %s", err, message)
+		}
+		return "", fmt.Errorf("secret command failed: %w", err)
+	}
+
+	value, _, _ := strings.Cut(stdout.String(), "\n")
+	value = strings.TrimRight(value, "\r")
+	if value == "" {
+		return "", fmt.Errorf("secret command printed nothing")
+	}
+	return value, nil
+}
+
+// RegisterSecretProvider makes credential references with the scheme resolve
+// through provider, replacing any provider registered for it before
+func (fs *FileStorage) RegisterSecretProvider(scheme string, provider SecretProvider) {
+	fs.providersMux.Lock()
+	defer fs.providersMux.Unlock()
+	fs.providers[scheme] = provider
+}
+
+// IsSecretRef reports whether a credential value is a reference to a registered provider
+func (fs *FileStorage) IsSecretRef(value string) bool {
+	_, _, err := fs.secretProvider(value)
+	return err == nil
+}
+
+// secretProvider splits a reference into the provider of its scheme and the rest
+func (fs *FileStorage) secretProvider(value string) (SecretProvider, string, error) {
+	scheme, ref, ok := strings.Cut(value, ":")
+	if !ok || ref == "" {
+		return nil, "", fmt.Errorf("invalid secret reference %q: use scheme:reference", value)
+	}
+
+	fs.providersMux.RLock()
+	provider, ok := fs.providers[scheme]
+	fs.providersMux.RUnlock()
+	if !ok {
+		return nil, "", fmt.Errorf("unknown secret provider %q", scheme)
+	}
+	return provider, ref, nil
+}
+
+// resolveCredentials returns the stored credentials with their references replaced
+// by the secrets they point to
+func (fs *FileStorage) resolveCredentials(name string, stored *Credential) (*Credential, error) {
+	creds := &Credential{Data: make(map[string]string, len(stored.Data)+len(stored.Refs))}
+	for key, value := range stored.Data {
+		creds.Data[key] = value
+	}
+
+	for key, ref := range stored.Refs {
+		provider, rest, err := fs.secretProvider(ref)
+		if err != nil {
+			return nil, fmt.Errorf("credential %s of %s: %w", key, name, err)
+		}
+		value, err := provider.Resolve(rest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to resolve credential %s of %s: %w", key, name, err)
+		}
+		creds.Data[key] = value
+	}
+	return creds, nil
+}
+
+// defaultSecretProviders returns the providers of the built-in reference schemes
+func defaultSecretProviders(fs *FileStorage) map[string]SecretProvider {
+	return map[string]SecretProvider{
+		SecretSchemeStore:   StoreProvider{storage: fs},
+		SecretSchemeEnv:     EnvProvider{},
+		SecretSchemeFile:    FileProvider{},
+		SecretSchemeCommand: NewCommandProvider(DefaultCommandTTL),
+	}
+}
@@ -0,0 +1,117 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCommandProviderRunsEachReferenceOnce(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands use sh")
+	}
+	runs := filepath.Join(t.TempDir(), "runs")
+	ref := fmt.Sprintf("echo run >> %s; sleep 0.2; echo token", runs)
+
+	p := NewCommandProvider(time.Minute)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if value, err := p.Resolve(ref); err != nil || value != "token" {
+				t.Errorf("Resolve = %q, %v; want token", value, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Cached afterwards
+	if value, err := p.Resolve(ref); err != nil || value != "token" {
+		t.Errorf("cached Resolve = %q, %v; want token", value, err)
+	}
+	data, _ := os.ReadFile(runs)
+	if n := strings.Count(string(data), "run"); n != 1 {
+		t.Errorf("the command ran %d times, want once", n)
+	}
+}
+
+func TestCommandProviderRunsReferencesInParallel(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the commands use sh")
+	}
+	p := NewCommandProvider(0)
+
+	start := time.Now()
+	var wg sync.WaitGroup
+	for _, ref := range []string{"sleep 0.5; echo a", "sleep 0.5; echo b"} {
+		wg.Add(1)
+		go func(ref string) {
+			defer wg.Done()
+			if _, err := p.Resolve(ref); err != nil {
+				t.Error(err)
+			}
+		}(ref)
+	}
+	wg.Wait()
+	if elapsed := time.Since(start); elapsed > 900*time.Millisecond {
+		t.Errorf("two commands took %s, want them to run in parallel", elapsed)
+	}
+
+	if _, err := p.Resolve("exit 3"); err == nil {
+		t.Error("a failing command resolved")
+	}
+}
+
+func TestResolveCredentials(t *testing.T) {
+	fs := newTestStorage(t)
+	t.Setenv("ONEMCP_TEST_TOKEN", "from-env")
+	secretFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(secretFile, []byte("from-file\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := fs.SaveCredentials("github", &Credential{Data: map[string]string{"TOKEN": "from-store"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := fs.SaveCredentials("issues", &Credential{
+		Data: map[string]string{"LITERAL": "env:NOT_A_REF"},
+		Refs: map[string]string{
+			"ENV":   "env:ONEMCP_TEST_TOKEN",
+			"FILE":  "file:" + secretFile,
+			"STORE": "store:github/TOKEN",
+		},
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	creds, err := fs.LoadCredentials("issues")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"LITERAL": "env:NOT_A_REF", "ENV": "from-env", "FILE": "from-file", "STORE": "from-store"}
+	for key, value := range want {
+		if creds.Data[key] != value {
+			t.Errorf("credential %s = %q, want %q", key, creds.Data[key], value)
+		}
+	}
+
+	// A reference that cannot be resolved fails the whole load
+	for _, ref := range []string{"env:ONEMCP_TEST_UNSET", "file:relative/path", "store:github/MISSING", "store:issues/ENV", "vault:x"} {
+		if err := fs.SaveCredentials("broken", &Credential{Refs: map[string]string{"KEY": ref}}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := fs.LoadCredentials("broken"); err == nil {
+			t.Errorf("LoadCredentials resolved %s", ref)
+		}
+	}
+
+	if !fs.IsSecretRef("store:github/TOKEN") || fs.IsSecretRef("ghp_plain") || fs.IsSecretRef("vault:x") {
+		t.Error("IsSecretRef does not match the registered schemes")
+	}
+}
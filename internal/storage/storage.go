@@ -2,9 +2,12 @@ package storage
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 )
 
@@ -12,9 +15,30 @@ import (
 type ServerType string
 
 const (
-	ServerTypeNPM  ServerType = "npm"
-	ServerTypePIP  ServerType = "pip"
+	ServerTypeNPM    ServerType = "npm"
+	ServerTypePIP    ServerType = "pip"
 	ServerTypeCustom ServerType = "custom"
+	ServerTypeRemote ServerType = "remote"
+)
+
+// Transports used to reach remote servers
+const (
+	RemoteTransportStreamable = "streamable"
+	RemoteTransportSSE        = "sse"
+)
+
+// Restart policies applied when a server exits
+const (
+	RestartAlways    = "always"
+	RestartOnFailure = "on-failure"
+	RestartNever     = "never"
+)
+
+// Activation modes deciding when a server is started
+const (
+	ActivationEager       = "eager"
+	ActivationLazy        = "lazy"
+	ActivationIdleTimeout = "idle-timeout"
 )
 
 // ServerStatus represents the status of an MCP server
@@ -30,24 +54,92 @@ const (
 // ServerConfig represents the configuration for an installed MCP server
 type ServerConfig struct {
 	Name         string                 `json:"name"`
-	Type         ServerType            `json:"type"`
+	Type         ServerType             `json:"type"`
 	Package      string                 `json:"package,omitempty"`
 	Version      string                 `json:"version,omitempty"`
-	InstalledAt  time.Time             `json:"installed_at"`
-	Status       ServerStatus          `json:"status"`
+	InstalledAt  time.Time              `json:"installed_at"`
+	Status       ServerStatus           `json:"status"`
 	Config       map[string]interface{} `json:"config,omitempty"`
-	Dependencies map[string]string     `json:"dependencies,omitempty"`
+	Dependencies map[string]string      `json:"dependencies,omitempty"`
 	Path         string                 `json:"path,omitempty"` // Installation path
+
+	// Command and Args launch a local server. Configurations without a Command
+	// derive it from Path, and Args are appended to the derived command.
+	Command string   `json:"command,omitempty"`
+	Args    []string `json:"args,omitempty"`
+	// Env sets environment variables of a local server; its credentials override them
+	Env map[string]string `json:"env,omitempty"`
+	// Cwd is the working directory of a local server
+	Cwd string `json:"cwd,omitempty"`
+	// InheritEnv names gateway environment variables passed on to a local server,
+	// in addition to basics such as PATH and HOME. Names may end in "*" to match a
+	// prefix; "*" alone passes on the whole environment.
+	InheritEnv []string `json:"inherit_env,omitempty"`
+
+	// Remote servers are reached over HTTP instead of being spawned
+	URL       string            `json:"url,omitempty"`
+	Transport string            `json:"transport,omitempty"` // "streamable" (default) or "sse"
+	Headers   map[string]string `json:"headers,omitempty"`
+	// CredentialHeaders maps header names to credential keys whose values are sent verbatim
+	CredentialHeaders map[string]string `json:"credential_headers,omitempty"`
+	// BearerCredential names the credential sent as "Authorization: Bearer <value>"
+	BearerCredential string `json:"bearer_credential,omitempty"`
+
+	// RestartPolicy is "always" (the default), "on-failure" or "never"
+	RestartPolicy string `json:"restart_policy,omitempty"`
+	// MaxRestarts within RestartWindow (a duration such as "10m") before the server is marked as errored
+	MaxRestarts   int    `json:"max_restarts,omitempty"`
+	RestartWindow string `json:"restart_window,omitempty"`
+
+	// Health checks ping the server every HealthCheckInterval ("0" disables them) and
+	// restart it after UnhealthyThreshold consecutive pings fail or exceed HealthCheckTimeout
+	HealthCheckInterval string `json:"health_check_interval,omitempty"`
+	HealthCheckTimeout  string `json:"health_check_timeout,omitempty"`
+	UnhealthyThreshold  int    `json:"unhealthy_threshold,omitempty"`
+
+	// StopGracePeriod is how long a stopping server is given to exit after its stdin
+	// is closed, and again after SIGTERM, before it is killed
+	StopGracePeriod string `json:"stop_grace_period,omitempty"`
+
+	// Activation is "eager" (the default: started with the gateway), "lazy" (started
+	// on first use) or "idle-timeout" (started on first use and stopped again after
+	// IdleTimeout, a duration such as "10m", without requests)
+	Activation  string `json:"activation,omitempty"`
+	IdleTimeout string `json:"idle_timeout,omitempty"`
+
+	// RequestTimeout overrides the gateway's timeout for requests to this server, and
+	// ToolTimeouts that for calls to single tools, keyed by the server's tool name
+	RequestTimeout string            `json:"request_timeout,omitempty"`
+	ToolTimeouts   map[string]string `json:"tool_timeouts,omitempty"`
+
+	// DenySampling refuses the server's requests to sample the client's LLM
+	DenySampling bool `json:"deny_sampling,omitempty"`
+
+	// RestartForClients restarts the running server when a client bringing sampling
+	// or elicitation connects after its handshake, so that it is offered them at
+	// once rather than on its next start
+	RestartForClients bool `json:"restart_for_clients,omitempty"`
 }
 
 // Credential represents API keys and credentials for a server
 type Credential struct {
 	Data map[string]string `json:"data"`
+	// Refs maps keys to secrets kept elsewhere, as references such as
+	// "cmd:pass show github/token" that a SecretProvider resolves
+	Refs map[string]string `json:"refs,omitempty"`
 }
 
 // FileStorage provides filesystem-based storage for MCP server data
 type FileStorage struct {
 	baseDir string
+
+	// key is the master key credentials are encrypted with, loaded on first use
+	key    []byte
+	prompt PassphrasePrompt
+	keyMux sync.Mutex
+
+	providers    map[string]SecretProvider
+	providersMux sync.RWMutex
 }
 
 // NewFileStorage creates a new filesystem-based storage instance
@@ -64,11 +156,17 @@ func NewFileStorage(baseDir string) (*FileStorage, error) {
 		}
 	}
 
-	return &FileStorage{baseDir: baseDir}, nil
+	fs := &FileStorage{baseDir: baseDir}
+	fs.providers = defaultSecretProviders(fs)
+	return fs, nil
 }
 
 // SaveServerConfig saves a server configuration
 func (fs *FileStorage) SaveServerConfig(server *ServerConfig) error {
+	if err := ValidateServerName(server.Name); err != nil {
+		return err
+	}
+
 	data, err := json.MarshalIndent(server, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to marshal server config: %w", err)
@@ -86,6 +184,11 @@ func (fs *FileStorage) SaveServerConfig(server *ServerConfig) error {
 
 // LoadServerConfig loads a server configuration
 func (fs *FileStorage) LoadServerConfig(name string) (*ServerConfig, error) {
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return nil, err
+	}
+
 	filename := fmt.Sprintf("%s.json", name)
 	path := filepath.Join(fs.baseDir, "servers", filename)
 
@@ -101,45 +204,57 @@ func (fs *FileStorage) LoadServerConfig(name string) (*ServerConfig, error) {
 	if err := json.Unmarshal(data, &config); err != nil {
 		return nil, fmt.Errorf("failed to parse server config: %w", err)
 	}
+	if err := checkConfigName(&config, path); err != nil {
+		return nil, err
+	}
 
 	return &config, nil
 }
 
 // ListServerConfigs returns all server configurations
 func (fs *FileStorage) ListServerConfigs() ([]*ServerConfig, error) {
-	fmt.Printf("DEBUG: ListServerConfigs called, baseDir: %s\n", fs.baseDir)
+	log.Printf("DEBUG: ListServerConfigs called, baseDir: %s", fs.baseDir)
 	pattern := filepath.Join(fs.baseDir, "servers", "*.json")
-	fmt.Printf("DEBUG: Pattern: %s\n", pattern)
+	log.Printf("DEBUG: Pattern: %s", pattern)
 	matches, err := filepath.Glob(pattern)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list server configs: %w", err)
 	}
 
-	fmt.Printf("DEBUG: Found %d matches\n", len(matches))
+	log.Printf("DEBUG: Found %d matches", len(matches))
 	var configs []*ServerConfig
 	for _, match := range matches {
-		fmt.Printf("DEBUG: Reading %s\n", match)
+		log.Printf("DEBUG: Reading %s", match)
 		data, err := os.ReadFile(match)
 		if err != nil {
-			fmt.Printf("DEBUG: Error reading %s: %v\n", match, err)
+			log.Printf("DEBUG: Error reading %s: %v", match, err)
 			continue // Skip files that can't be read
 		}
 
 		var config ServerConfig
 		if err := json.Unmarshal(data, &config); err != nil {
-			fmt.Printf("DEBUG: Error unmarshaling %s: %v\n", match, err)
+			log.Printf("DEBUG: Error unmarshaling %s: %v", match, err)
 			continue // Skip invalid files
 		}
+		if err := checkConfigName(&config, match); err != nil {
+			log.Printf("Skipping server config %s: %v; run 'onemcp migrate', or rename or remove the file", match, err)
+			continue
+		}
 
 		configs = append(configs, &config)
 	}
 
-	fmt.Printf("DEBUG: Returning %d configs\n", len(configs))
+	log.Printf("DEBUG: Returning %d configs", len(configs))
 	return configs, nil
 }
 
 // DeleteServerConfig deletes a server configuration
 func (fs *FileStorage) DeleteServerConfig(name string) error {
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return err
+	}
+
 	filename := fmt.Sprintf("%s.json", name)
 	path := filepath.Join(fs.baseDir, "servers", filename)
 
@@ -147,49 +262,149 @@ func (fs *FileStorage) DeleteServerConfig(name string) error {
 		return fmt.Errorf("failed to delete server config: %w", err)
 	}
 
+	// The cached catalog describes the removed configuration
+	if err := os.Remove(fs.GetCatalogPath(name)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete cached catalog: %w", err)
+	}
+
 	return nil
 }
 
-// SaveCredentials saves credentials for a server
+// SaveCredentials encrypts and saves credentials for a server
 func (fs *FileStorage) SaveCredentials(name string, creds *Credential) error {
-	data, err := json.MarshalIndent(creds, "", "  ")
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return err
+	}
+
+	key, err := fs.masterKey()
+	if err != nil {
+		return err
+	}
+	return writeCredentials(fs.GetCredentialsPath(name), name, creds, key)
+}
+
+// writeCredentials encrypts the credentials of a server with key and writes them to path
+func writeCredentials(path, name string, creds *Credential, key []byte) error {
+	data, err := json.Marshal(creds)
 	if err != nil {
 		return fmt.Errorf("failed to marshal credentials: %w", err)
 	}
 
-	filename := fmt.Sprintf("%s.key", name)
-	path := filepath.Join(fs.baseDir, "credentials", filename)
+	box, err := seal(key, data, name)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt credentials: %w", err)
+	}
+	data, err = json.MarshalIndent(box, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal credentials: %w", err)
+	}
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
+	if err := writeFileAtomic(path, data, 0600); err != nil {
 		return fmt.Errorf("failed to write credentials: %w", err)
 	}
 
 	return nil
 }
 
-// LoadCredentials loads credentials for a server
+// LoadCredentials loads the credentials of a server with their references resolved
+// through the secret providers, ready to be handed to the server
 func (fs *FileStorage) LoadCredentials(name string) (*Credential, error) {
-	filename := fmt.Sprintf("%s.key", name)
-	path := filepath.Join(fs.baseDir, "credentials", filename)
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return nil, err
+	}
 
-	data, err := os.ReadFile(path)
+	stored, err := fs.LoadStoredCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+	return fs.resolveCredentials(name, stored)
+}
+
+// LoadStoredCredentials loads and decrypts the credentials of a server as stored,
+// with references unresolved. Credentials stored in plain text by earlier versions
+// are encrypted on the way.
+func (fs *FileStorage) LoadStoredCredentials(name string) (*Credential, error) {
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, plain, err := fs.readCredentials(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if plain {
+		if err := fs.SaveCredentials(name, creds); err != nil {
+			return nil, fmt.Errorf("failed to encrypt the plain text credentials of %s: %w", name, err)
+		}
+		log.Printf("Encrypted the plain text credentials of %s", name)
+	}
+	return creds, nil
+}
+
+// readCredentials reads the credentials of a server, decrypting them unless they
+// are stored in plain text. It reports which was the case.
+func (fs *FileStorage) readCredentials(name string) (*Credential, bool, error) {
+	data, err := os.ReadFile(fs.GetCredentialsPath(name))
 	if err != nil {
 		if os.IsNotExist(err) {
-			return nil, fmt.Errorf("credentials for %s not found", name)
+			return nil, false, fmt.Errorf("credentials for %s: %w", name, ErrNoCredentials)
+		}
+		return nil, false, fmt.Errorf("failed to read credentials: %w", err)
+	}
+
+	var box sealed
+	if err := json.Unmarshal(data, &box); err != nil {
+		return nil, false, fmt.Errorf("failed to parse credentials: %w", err)
+	}
+
+	if box.Cipher == "" {
+		var creds Credential
+		if err := json.Unmarshal(data, &creds); err != nil {
+			return nil, false, fmt.Errorf("failed to parse credentials: %w", err)
+		}
+		return &creds, true, nil
+	}
+
+	key, err := fs.masterKey()
+	if err != nil {
+		return nil, false, err
+	}
+	creds, err := openCredentials(key, &box, name)
+	if errors.Is(err, ErrWrongKey) && fs.forgetKey() {
+		// Another process may have rekeyed the credentials; load the key afresh
+		if key, err = fs.masterKey(); err != nil {
+			return nil, false, err
 		}
-		return nil, fmt.Errorf("failed to read credentials: %w", err)
+		creds, err = openCredentials(key, &box, name)
+	}
+	return creds, false, err
+}
+
+// openCredentials decrypts the credentials of a server
+func openCredentials(key []byte, box *sealed, name string) (*Credential, error) {
+	data, err := openSealed(key, box, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt credentials for %s: %w", name, ErrWrongKey)
 	}
 
 	var creds Credential
 	if err := json.Unmarshal(data, &creds); err != nil {
 		return nil, fmt.Errorf("failed to parse credentials: %w", err)
 	}
-
 	return &creds, nil
 }
 
 // DeleteCredentials deletes credentials for a server
 func (fs *FileStorage) DeleteCredentials(name string) error {
+	name, err := NormalizeServerName(name)
+	if err != nil {
+		return err
+	}
+
 	filename := fmt.Sprintf("%s.key", name)
 	path := filepath.Join(fs.baseDir, "credentials", filename)
 
@@ -205,11 +420,21 @@ func (fs *FileStorage) GetLogPath(name string) string {
 	return filepath.Join(fs.baseDir, "logs", fmt.Sprintf("%s.log", name))
 }
 
+// GetBaseDir returns the directory all OneMCP data lives in
+func (fs *FileStorage) GetBaseDir() string {
+	return fs.baseDir
+}
+
 // GetCacheDir returns the cache directory
 func (fs *FileStorage) GetCacheDir() string {
 	return filepath.Join(fs.baseDir, "cache")
 }
 
+// GetCatalogPath returns the path of a server's cached tool catalog
+func (fs *FileStorage) GetCatalogPath(name string) string {
+	return filepath.Join(fs.GetCacheDir(), "catalog", fmt.Sprintf("%s.json", name))
+}
+
 // GetServersDir returns the servers directory
 func (fs *FileStorage) GetServersDir() string {
 	return filepath.Join(fs.baseDir, "servers")
@@ -228,4 +453,4 @@ func (fs *FileStorage) GetLogsDir() string {
 // GetCredentialsPath returns the path to a server's credentials file
 func (fs *FileStorage) GetCredentialsPath(serverName string) string {
 	return filepath.Join(fs.GetCredentialsDir(), serverName+".key")
-}
\ No newline at end of file
+}
@@ -9,7 +9,7 @@ import (
 	"strings"
 
 	"github.com/mdarshad-ai/OneMCP/internal/config"
-	"github.com/mdarshad-ai/OneMCP/internal/gateway"
+	"github.com/mdarshad-ai/OneMCP/internal/daemon"
 	"github.com/mdarshad-ai/OneMCP/internal/storage"
 )
 
@@ -20,20 +20,23 @@ type ServerInfo struct {
 	Version string `json:"version"`
 	Status  string `json:"status"`
 	Path    string `json:"path"`
+
+	ExitCode  *int   `json:"exit_code,omitempty"`
+	LastError string `json:"last_error,omitempty"`
 }
 
 // Server represents the web server
 type Server struct {
 	config *config.Config
-	gw     *gateway.Gateway
+	daemon *daemon.Client
 	store  *storage.FileStorage
 }
 
 // NewServer creates a new web server
-func NewServer(cfg *config.Config, gw *gateway.Gateway, store *storage.FileStorage) *Server {
+func NewServer(cfg *config.Config, client *daemon.Client, store *storage.FileStorage) *Server {
 	return &Server{
 		config: cfg,
-		gw:     gw,
+		daemon: client,
 		store:  store,
 	}
 }
@@ -108,6 +111,7 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
         .status-running { background: #d4edda; color: #155724; }
         .status-stopped { background: #f8d7da; color: #721c24; }
         .status-error { background: #fff3cd; color: #856404; }
+        .status-idle { background: #e2e3e5; color: #383d41; }
         .server-actions { display: flex; gap: 10px; }
         .client-grid { display: grid; grid-template-columns: repeat(auto-fit, minmax(300px, 1fr)); gap: 20px; }
         .client-card { background: white; border: 1px solid #e9ecef; border-radius: 10px; padding: 25px; text-align: center; transition: all 0.3s; }
@@ -321,10 +325,14 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
                                 '<h4><i class="fas fa-server"></i> ' + server.name + '</h4>' +
                                 '<div class="server-meta">' + server.type + ' • v' + server.version + '</div>' +
                                 '<span class="status-badge status-' + server.status + '">' + server.status + '</span>' +
+                                (server.status === 'error' && server.exit_code !== undefined ?
+                                    '<div class="server-meta">Last exit code ' + server.exit_code + '</div>' : '') +
                             '</div>' +
                             '<div class="server-actions">' +
                                 (server.status === 'running' ?
                                     '<button class="btn btn-danger" onclick="stopServer(\'' + server.name + '\')"><i class="fas fa-stop"></i> Stop</button>' :
+                                 server.status === 'error' ?
+                                    '<button class="btn btn-success" onclick="resetServer(\'' + server.name + '\')"><i class="fas fa-redo"></i> Reset</button>' :
                                     '<button class="btn btn-success" onclick="startServer(\'' + server.name + '\')"><i class="fas fa-play"></i> Start</button>') +
                                 '<button class="btn btn-secondary" onclick="viewLogs(\'' + server.name + '\')"><i class="fas fa-eye"></i> Logs</button>' +
                                 '<button class="btn btn-danger" onclick="removeServer(\'' + server.name + '\')"><i class="fas fa-trash"></i> Remove</button>' +
@@ -384,6 +392,10 @@ func (s *Server) handleIndex(w http.ResponseWriter, r *http.Request) {
             serverAction(name, 'stop', 'Stopping server...');
         }
 
+        function resetServer(name) {
+            serverAction(name, 'reset', 'Resetting server...');
+        }
+
         function serverAction(name, action, loadingText) {
             var btn = event.target;
             var originalText = btn.innerHTML;
@@ -585,9 +597,8 @@ func (s *Server) handleServerActions(w http.ResponseWriter, r *http.Request) {
 	slashIndex := strings.Index(path, "/")
 	if slashIndex == -1 {
 		// No action, just server name
-		serverName := path
-		if serverName == "" {
-			http.Error(w, "Server name required", http.StatusBadRequest)
+		serverName, ok := validServerName(w, path)
+		if !ok {
 			return
 		}
 
@@ -601,13 +612,11 @@ func (s *Server) handleServerActions(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Has action
-	serverName := path[:slashIndex]
-	action := path[slashIndex+1:]
-
-	if serverName == "" {
-		http.Error(w, "Server name required", http.StatusBadRequest)
+	serverName, ok := validServerName(w, path[:slashIndex])
+	if !ok {
 		return
 	}
+	action := path[slashIndex+1:]
 
 	switch action {
 	case "start":
@@ -620,11 +629,32 @@ func (s *Server) handleServerActions(w http.ResponseWriter, r *http.Request) {
 			s.stopServer(w, r, serverName)
 			return
 		}
+	case "reset":
+		if r.Method == "POST" {
+			s.resetServer(w, r, serverName)
+			return
+		}
 	}
 
 	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 }
 
+// validServerName normalizes a server name from a request, answering the request
+// with an error if the name is invalid
+func validServerName(w http.ResponseWriter, name string) (string, bool) {
+	if name == "" {
+		http.Error(w, "Server name required", http.StatusBadRequest)
+		return "", false
+	}
+
+	normalized, err := storage.NormalizeServerName(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return "", false
+	}
+	return normalized, true
+}
+
 // handleConfig handles the /api/config endpoint
 func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 	switch r.Method {
@@ -638,17 +668,23 @@ func (s *Server) handleConfig(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Server) getServers(w http.ResponseWriter, r *http.Request) {
-	serversMap := s.gw.ListServers()
+	serversMap, err := s.daemon.ListServers()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
 
 	// Convert map to array for JSON response
 	servers := make([]ServerInfo, 0, len(serversMap))
 	for _, server := range serversMap {
 		servers = append(servers, ServerInfo{
-			Name:    server.Name,
-			Type:    server.Type,
-			Version: server.Version,
-			Status:  server.Status,
-			Path:    server.Path,
+			Name:      server.Name,
+			Type:      server.Type,
+			Version:   server.Version,
+			Status:    server.Status,
+			Path:      server.Path,
+			ExitCode:  server.ExitCode,
+			LastError: server.LastError,
 		})
 	}
 
@@ -667,6 +703,9 @@ func (s *Server) addServer(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
+	if _, ok := validServerName(w, req.Name); !ok {
+		return
+	}
 
 	// Here we would call the installer, but for now just return success
 	w.Header().Set("Content-Type", "application/json")
@@ -680,7 +719,7 @@ func (s *Server) removeServer(w http.ResponseWriter, r *http.Request, name strin
 }
 
 func (s *Server) startServer(w http.ResponseWriter, r *http.Request, name string) {
-	if err := s.gw.StartServer(name); err != nil {
+	if err := s.daemon.StartServer(name); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -690,7 +729,17 @@ func (s *Server) startServer(w http.ResponseWriter, r *http.Request, name string
 }
 
 func (s *Server) stopServer(w http.ResponseWriter, r *http.Request, name string) {
-	if err := s.gw.StopServer(name); err != nil {
+	if err := s.daemon.StopServer(name); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "success"})
+}
+
+func (s *Server) resetServer(w http.ResponseWriter, r *http.Request, name string) {
+	if err := s.daemon.ResetServer(name); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}